@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/cespare/xxhash/v2"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// the endpoints the zero uses to move keys between groups when a group is
+// added to the hash ring or a relation is placed on a group. The keys that
+// move are frozen first, the writes to them are refused with a 503 until
+// they are served by their new group, so the copy the zero makes is exact.
+
+// frozenKey holds the partitionRequest of the keys being moved
+const frozenKey = reservedPrefix + "frozen"
+
+var errFrozen = errors.New("the key is moving to another group, retry")
+
+// partitionRequest selects the keys to work on, by partition of the zero
+// hash ring, by relation or both
+type partitionRequest struct {
+	Partitions     []int  `json:"partitions,omitempty"`
+	PartitionCount int    `json:"partitionCount,omitempty"`
+	Relation       string `json:"relation,omitempty"`
+	// relations to leave alone, they are placed on a group as a whole
+	Exclude []string `json:"exclude,omitempty"`
+	// an export starts past this key, to resume one
+	After string `json:"after,omitempty"`
+}
+
+// valid refuses the requests that would select every key
+func (req *partitionRequest) valid() bool {
+	return (len(req.Partitions) > 0 && req.PartitionCount > 0) || req.Relation != ""
+}
+
+func (req *partitionRequest) matcher() func(key []byte) bool {
+	parts := make(map[int]bool, len(req.Partitions))
+	for _, p := range req.Partitions {
+		parts[p] = true
+	}
+	exclude := make(map[string]bool, len(req.Exclude))
+	for _, r := range req.Exclude {
+		exclude[r] = true
+	}
+	return func(key []byte) bool {
+		if reserved(key) {
+			return false
+		}
+		relation := relationOf(key)
+		if exclude[relation] || (req.Relation != "" && relation != req.Relation) {
+			return false
+		}
+		return len(parts) == 0 || parts[partitionOf(key, req.PartitionCount)]
+	}
+}
+
+// relationOf returns the relation of a id%relation key
+func relationOf(key []byte) string {
+	i := bytes.Index(key, []byte(SEPARATOR))
+	if i < 0 {
+		return ""
+	}
+	return string(key[i+len(SEPARATOR):])
+}
+
+type keyValue struct {
+	Key   string      `json:"key,omitempty"`
+	Value []edgeValue `json:"value,omitempty"`
+	// marks the end of an export so that a truncated one is noticed
+	Done bool `json:"done,omitempty"`
+}
+
+// partitionOf must hash the same way as the zero ring does
+func partitionOf(key []byte, count int) int {
+	return int(xxhash.Sum64(key) % uint64(count))
+}
+
+// apply replicates the event and returns its raft index or the error of
+// the FSM if any
+func (s *server) apply(e *event) (uint64, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+	f := s.raft.Apply(b, raftTimeout)
+	if err := f.Error(); err != nil {
+		return 0, err
+	}
+	if err, ok := f.Response().(error); ok {
+		return 0, err
+	}
+	return f.Index(), nil
+}
+
+// export calls fn for every key selected by the request
+func (s *server) export(req *partitionRequest, fn func(kv *keyValue) error) error {
+	match := req.matcher()
+	return s.fsm.view(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		it.Rewind()
+		if req.After != "" {
+			it.Seek([]byte(req.After))
+		}
+		for ; it.Valid(); it.Next() {
+			item := it.Item()
+			if !match(item.Key()) || string(item.Key()) == req.After {
+				continue
+			}
+			kv := keyValue{Key: string(item.KeyCopy(nil))}
+			err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &kv.Value)
+			})
+			if err != nil {
+				return err
+			}
+			if err := fn(&kv); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *server) merge(batch map[string][]edgeValue) error {
+	_, err := s.apply(&event{OpType: mrg, Batch: batch})
+	return err
+}
+
+// edit removes and adds values of many keys in a single entry of the log
+func (s *server) edit(remove map[string][]string, add map[string][]edgeValue) error {
+	_, err := s.apply(&event{OpType: edt, Remove: remove, Batch: add})
+	return err
+}
+
+// freeze refuses the writes to the keys selected by the request
+func (s *server) freeze(req *partitionRequest) error {
+	_, err := s.apply(&event{
+		OpType:         frz,
+		Relation:       req.Relation,
+		Partitions:     req.Partitions,
+		PartitionCount: req.PartitionCount,
+		Exclude:        req.Exclude,
+	})
+	return err
+}
+
+func (s *server) thaw() error {
+	_, err := s.apply(&event{OpType: thw})
+	return err
+}
+
+func (s *server) purge(req *partitionRequest) error {
+	_, err := s.apply(&event{
+		OpType:         prg,
+		Relation:       req.Relation,
+		Partitions:     req.Partitions,
+		PartitionCount: req.PartitionCount,
+		Exclude:        req.Exclude,
+	})
+	return err
+}
+
+func readPartitionRequest(r *http.Request) (*partitionRequest, error) {
+	b, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var req partitionRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// handleExport streams the keys of the partitions as json lines
+func (s *httpService) handleExport(w http.ResponseWriter, r *http.Request) {
+	req, err := readPartitionRequest(r)
+	if err != nil || !req.valid() {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if s.store.raft.State() != raft.Leader {
+		s.fail(w, "Could not export partitions", raft.ErrNotLeader)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	err = s.store.export(req, func(kv *keyValue) error {
+		return enc.Encode(kv)
+	})
+	if err != nil {
+		// the status is gone already, the zero notices the missing end
+		s.logger.Error("Could not export partitions", zap.Error(err))
+		return
+	}
+	if err := enc.Encode(&keyValue{Done: true}); err != nil {
+		s.logger.Error("Error in writing response", zap.Error(err))
+	}
+}
+
+func (s *httpService) handleImport(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		s.writeError(w, 400, "Could not open request body")
+		return
+	}
+	type message struct {
+		Batch map[string][]edgeValue `json:"batch"`
+	}
+	var msg message
+	if err := json.Unmarshal(b, &msg); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if err := s.store.merge(msg.Batch); err != nil {
+		s.fail(w, "Could not import the keys", err)
+		return
+	}
+}
+
+// handleEdges removes and then adds values of many keys, a value in both is
+// set with the facets it comes with
+//
+//	{"remove": {"bob%~friend": ["carol"]}, "add": {"bob%~friend": ["alice"]}}
+func (s *httpService) handleEdges(w http.ResponseWriter, r *http.Request) {
+	var msg struct {
+		Remove map[string][]string    `json:"remove"`
+		Add    map[string][]edgeValue `json:"add"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	for k := range msg.Remove {
+		if reserved([]byte(k)) {
+			s.writeError(w, 400, "The reserved keys can not be written")
+			return
+		}
+	}
+	for k := range msg.Add {
+		if reserved([]byte(k)) {
+			s.writeError(w, 400, "The reserved keys can not be written")
+			return
+		}
+	}
+	if err := s.store.edit(msg.Remove, msg.Add); err != nil {
+		s.fail(w, "Could not edit the keys", err)
+		return
+	}
+}
+
+func (s *httpService) handlePurge(w http.ResponseWriter, r *http.Request) {
+	req, err := readPartitionRequest(r)
+	if err != nil || !req.valid() {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	start := time.Now()
+	if err := s.store.purge(req); err != nil {
+		s.fail(w, "Could not purge partitions", err)
+		return
+	}
+	s.logger.Info("Purged partitions", zap.Int("partitions", len(req.Partitions)), zap.Duration("took", time.Since(start)))
+}
+
+func (s *httpService) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	req, err := readPartitionRequest(r)
+	if err != nil || !req.valid() {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if err := s.store.freeze(req); err != nil {
+		s.fail(w, "Could not freeze the keys", err)
+		return
+	}
+	s.logger.Info("Froze the keys to move", zap.Int("partitions", len(req.Partitions)), zap.String("relation", req.Relation))
+}
+
+func (s *httpService) handleThaw(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.thaw(); err != nil {
+		s.fail(w, "Could not thaw the keys", err)
+		return
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"github.com/dgraph-io/badger/v3"
+)
+
+// POST /batch reads many keys at once from a single view of the store, the
+// zero sends there the reads of a query that land on this group
+//
+//	{"keys": [{"id": "alice", "relation": "friend"}, {"id": "bob", "relation": "friend"}]}
+//
+// The answer holds the values in the order of the keys, null for a missing key
+//
+//	{"values": [["bob", "carol"], null]}
+//
+// It takes ?consistency= like a GET.
+
+type batchKey struct {
+	Id       string `json:"id"`
+	Relation string `json:"relation"`
+}
+
+type batchResult struct {
+	Values [][]edgeValue `json:"values"`
+}
+
+// getMany reads the keys in one transaction, missing keys are nil
+func (s *server) getMany(keys []batchKey) ([][]edgeValue, error) {
+	out := make([][]edgeValue, len(keys))
+	err := s.fsm.view(func(txn *badger.Txn) error {
+		for i, k := range keys {
+			item, err := txn.Get([]byte(k.Id + SEPARATOR + k.Relation))
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			err = item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &out[i])
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *httpService) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Keys []batchKey `json:"keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if len(req.Keys) > pb.MaxBatchKeys {
+		s.writeError(w, 400, fmt.Sprintf("A batch reads at most %d keys", pb.MaxBatchKeys))
+		return
+	}
+	for _, k := range req.Keys {
+		if reserved([]byte(k.Id)) {
+			s.writeError(w, 400, "The reserved keys can not be read")
+			return
+		}
+	}
+	level := r.URL.Query().Get("consistency")
+	if level == "" {
+		level = defaultConsistency
+	}
+	if err := s.store.waitReadable(level); err != nil {
+		s.fail(w, "Could not read at the requested consistency", err)
+		return
+	}
+	values, err := s.store.getMany(req.Keys)
+	if err != nil {
+		s.fail(w, "Could not read the keys", err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, &batchResult{Values: values})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// A read picks how fresh its answer has to be with ?consistency=
+//   - linearizable, the default, sees every write acknowledged before the read
+//     started, only the leader serves it once it made sure it still is the leader
+//   - leader is served by the node that thinks it is the leader, a deposed
+//     leader can answer until it notices
+//   - stale is served by any replica from what it applied so far
+const (
+	linearizable = "linearizable"
+	leaderRead   = "leader"
+	staleRead    = "stale"
+
+	defaultConsistency = linearizable
+	readIndexPoll      = time.Millisecond
+)
+
+var (
+	errConsistency = errors.New("the consistency should be linearizable, leader or stale")
+	errReadTimeout = errors.New("timed out waiting for the read index to be applied")
+)
+
+// waitReadable returns once the node can serve a read at the given level
+func (s *server) waitReadable(level string) error {
+	switch level {
+	case staleRead:
+		return nil
+	case leaderRead:
+		if s.raft.State() != raft.Leader {
+			return raft.ErrNotLeader
+		}
+		return nil
+	case linearizable:
+		return s.readIndex()
+	default:
+		return errConsistency
+	}
+}
+
+// readIndex notes the commit index, checks with a quorum that we are still
+// the leader and waits for the index to be applied, the store then holds
+// every write committed before the read arrived
+func (s *server) readIndex() error {
+	if s.raft.State() != raft.Leader {
+		return raft.ErrNotLeader
+	}
+	// this version of raft only tells the commit index through its stats
+	index, err := strconv.ParseUint(s.raft.Stats()["commit_index"], 10, 64)
+	if err != nil {
+		return err
+	}
+	if err := s.raft.VerifyLeader().Error(); err != nil {
+		return raft.ErrNotLeader
+	}
+	deadline := time.Now().Add(raftTimeout)
+	for s.raft.AppliedIndex() < index {
+		if time.Now().After(deadline) {
+			return errReadTimeout
+		}
+		time.Sleep(readIndexPoll)
+	}
+	return nil
+}
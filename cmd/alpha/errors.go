@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+)
+
+// Every error is answered with a JSON body, the code tells the kind of
+// failure and the leader is set when the node is not the leader
+//
+//	{"code": "not_leader", "error": "Not the leader of the group", "leader": "localhost:8001"}
+//
+// 400 bad input, 404 unknown key, 421 not the leader, 503 the group can not
+// serve the request right now, 500 anything else.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+	Leader  string `json:"leader,omitempty"`
+}
+
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusNotFound:            "not_found",
+	http.StatusMisdirectedRequest:  "not_leader",
+	http.StatusInternalServerError: "internal",
+	http.StatusServiceUnavailable:  "unavailable",
+}
+
+// writeResult is the answer to a write, index is the raft log index of the
+// write, a read at that index or later sees it
+type writeResult struct {
+	Index uint64 `json:"index"`
+}
+
+// errorStatus maps the errors of the store and of raft to a status
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, badger.ErrKeyNotFound):
+		return http.StatusNotFound
+	case err == raft.ErrNotLeader, err == raft.ErrLeadershipLost, err == raft.ErrLeadershipTransferInProgress:
+		return http.StatusMisdirectedRequest
+	case err == errConsistency:
+		return http.StatusBadRequest
+	case err == raft.ErrEnqueueTimeout, err == raft.ErrRaftShutdown, err == errReadTimeout, err == errUnknownLeader,
+		err == errFrozen:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (s *httpService) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		s.logger.Error("Could not marshal the response", zap.Error(err))
+		status, b = http.StatusInternalServerError, []byte(`{"code":"internal","error":"Could not marshal the response"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		s.logger.Error("Error in writing response", zap.Error(err))
+	}
+}
+
+func (s *httpService) writeError(w http.ResponseWriter, status int, msg string) {
+	e := &apiError{Code: errorCodes[status], Message: msg}
+	if status == http.StatusMisdirectedRequest {
+		if leader, err := s.store.leaderHTTP(); err == nil {
+			e.Leader = leader
+			w.Header().Set(leaderHeader, leader)
+		}
+	}
+	s.writeJSON(w, status, e)
+}
+
+// fail answers with the status of err, msg says what we were doing
+func (s *httpService) fail(w http.ResponseWriter, msg string, err error) {
+	status := errorStatus(err)
+	switch status {
+	case http.StatusNotFound:
+		msg = "The key does not exist"
+	case http.StatusMisdirectedRequest:
+		msg = "Not the leader of the group"
+	case http.StatusInternalServerError:
+		s.logger.Error(msg, zap.Error(err))
+		msg += ": " + err.Error()
+	default:
+		msg += ": " + err.Error()
+	}
+	s.writeError(w, status, msg)
+}
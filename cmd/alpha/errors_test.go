@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+)
+
+func TestFail(t *testing.T) {
+	n := newTestNode(t, "a1")
+	err := n.raft.BootstrapCluster(raft.Configuration{Servers: []raft.Server{{
+		ID:      "a1",
+		Address: n.transport.LocalAddr(),
+	}}}).Error()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-n.raft.LeaderCh():
+	case <-time.After(5 * time.Second):
+		t.Fatal("a1 did not become the leader")
+	}
+	err = n.fsm.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(peerPrefix+"a1"), []byte(`["localhost:8001"]`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &httpService{store: &server{raft: n.raft, fsm: n.fsm, db: n.fsm.db}, logger: zap.NewNop()}
+
+	tests := []struct {
+		err    error
+		status int
+		want   apiError
+	}{
+		{fmt.Errorf("reading n1: %w", badger.ErrKeyNotFound), http.StatusNotFound,
+			apiError{Code: "not_found", Message: "The key does not exist"}},
+		{raft.ErrNotLeader, http.StatusMisdirectedRequest,
+			apiError{Code: "not_leader", Message: "Not the leader of the group", Leader: "localhost:8001"}},
+		{errConsistency, http.StatusBadRequest,
+			apiError{Code: "bad_request", Message: "Could not read: " + errConsistency.Error()}},
+		{errFrozen, http.StatusServiceUnavailable,
+			apiError{Code: "unavailable", Message: "Could not read: " + errFrozen.Error()}},
+		{errors.New("disk full"), http.StatusInternalServerError,
+			apiError{Code: "internal", Message: "Could not read: disk full"}},
+	}
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.status {
+			t.Errorf("errorStatus(%v) = %d, want %d", tt.err, got, tt.status)
+		}
+		w := httptest.NewRecorder()
+		s.fail(w, "Could not read", tt.err)
+		if w.Code != tt.status {
+			t.Errorf("fail(%v) answered %d, want %d", tt.err, w.Code, tt.status)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("fail(%v) answered the content type %q", tt.err, ct)
+		}
+		if got := w.Header().Get(leaderHeader); got != tt.want.Leader {
+			t.Errorf("fail(%v) set the leader header to %q, want %q", tt.err, got, tt.want.Leader)
+		}
+		var got apiError
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("fail(%v) answered %q: %v", tt.err, w.Body.String(), err)
+		}
+		if got != tt.want {
+			t.Errorf("fail(%v) answered %+v, want %+v", tt.err, got, tt.want)
+		}
+	}
+}
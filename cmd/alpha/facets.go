@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+)
+
+// An edge can carry facets, typed properties such as the date a friendship
+// started or a weight, the format they are written in is shared with the zero.
+// A facet is a string, a number or a boolean.
+
+var errFacetType = errors.New("the facets should be strings, numbers or booleans with a name")
+
+// edgeValue is a value of a relation with the facets of its edge
+type (
+	edgeValue  = pb.EdgeValue
+	edgeObject = pb.EdgeObject
+)
+
+// checkFacets refuses the facets we can not compare
+func checkFacets(facets map[string]interface{}) error {
+	for name, f := range facets {
+		if name == "" {
+			return errFacetType
+		}
+		switch f.(type) {
+		case string, float64, bool:
+		default:
+			return errFacetType
+		}
+	}
+	return nil
+}
+
+// addValues adds the values to the list, which holds each value once. A value
+// already there that comes with facets gets them instead of being added
+// again, the repeats of the lists written before are dropped on the way.
+func addValues(cur, vals []edgeValue) []edgeValue {
+	out := make([]edgeValue, 0, len(cur)+len(vals))
+	at := make(map[string]int, len(cur)+len(vals))
+	for _, v := range append(cur, vals...) {
+		i, ok := at[v.Value]
+		switch {
+		case !ok:
+			at[v.Value] = len(out)
+			out = append(out, v)
+		case len(v.Facets) > 0:
+			out[i].Facets = v.Facets
+		}
+	}
+	return out
+}
+
+// replaceValues makes the values the whole list, a value kept keeps its
+// facets unless it comes with new ones
+func replaceValues(cur, vals []edgeValue) []edgeValue {
+	keep := make(map[string]bool, len(vals))
+	for _, v := range vals {
+		keep[v.Value] = true
+	}
+	var kept []edgeValue
+	for _, v := range cur {
+		if keep[v.Value] {
+			kept = append(kept, v)
+		}
+	}
+	return addValues(kept, vals)
+}
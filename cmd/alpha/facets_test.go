@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAddValues(t *testing.T) {
+	since := func(v, date string) edgeValue {
+		return edgeValue{Value: v, Facets: map[string]interface{}{"since": date}}
+	}
+	tests := []struct {
+		name      string
+		cur, vals []edgeValue
+		want      []edgeValue
+	}{
+		{"to nothing", nil, strs("bob", "carol"), strs("bob", "carol")},
+		{"kept once", strs("bob"), strs("bob", "carol", "carol"), strs("bob", "carol")},
+		{"repeats written before", strs("bob", "bob", "carol", "bob"), nil, strs("bob", "carol")},
+		{"facets replaced", []edgeValue{since("bob", "2019")}, []edgeValue{since("bob", "2021")}, []edgeValue{since("bob", "2021")}},
+		{"facets added", strs("bob"), []edgeValue{since("bob", "2021")}, []edgeValue{since("bob", "2021")}},
+		{"facets kept without new ones", []edgeValue{since("bob", "2019")}, strs("bob"), []edgeValue{since("bob", "2019")}},
+		{"order kept", []edgeValue{since("bob", "2019"), since("carol", "2020")}, []edgeValue{since("bob", "2021"), since("dave", "2022")}, []edgeValue{since("bob", "2021"), since("carol", "2020"), since("dave", "2022")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addValues(tt.cur, tt.vals); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("addValues(%v, %v) = %v, want %v", tt.cur, tt.vals, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEdgeValueJSON(t *testing.T) {
+	vals := []edgeValue{
+		{Value: "bob"},
+		{Value: "carol", Facets: map[string]interface{}{"since": "2019-04-01", "weight": 2.0, "close": true}},
+	}
+	b, err := json.Marshal(vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `["bob",{"value":"carol","facets":{"close":true,"since":"2019-04-01","weight":2}}]`
+	if string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+	var got []edgeValue
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, vals) {
+		t.Errorf("read back %v, want %v", got, vals)
+	}
+}
+
+func TestReplaceValues(t *testing.T) {
+	since := func(v, date string) edgeValue {
+		return edgeValue{Value: v, Facets: map[string]interface{}{"since": date}}
+	}
+	tests := []struct {
+		name      string
+		cur, vals []edgeValue
+		want      []edgeValue
+	}{
+		{"to nothing", nil, strs("bob"), strs("bob")},
+		{"replaced", strs("bob"), strs("carol"), strs("carol")},
+		{"every value replaced", strs("bob", "carol"), strs("dave"), strs("dave")},
+		{"same value keeps its facets", []edgeValue{since("bob", "2019")}, strs("bob"), []edgeValue{since("bob", "2019")}},
+		{"same value with new facets", []edgeValue{since("bob", "2019")}, []edgeValue{since("bob", "2021")}, []edgeValue{since("bob", "2021")}},
+		{"facets of the replaced value dropped", []edgeValue{since("bob", "2019")}, strs("carol"), strs("carol")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceValues(tt.cur, tt.vals); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("replaceValues(%v, %v) = %v, want %v", tt.cur, tt.vals, got, tt.want)
+			}
+		})
+	}
+}
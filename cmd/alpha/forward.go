@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+)
+
+// Writes have to go through the leader of the group. A follower passes them
+// on to it, raft tells the raft address of the leader and the HTTP address
+// is found in the store, every node records its own when it becomes the
+// leader. With -forward=false the follower answers 421 and names the leader.
+
+const (
+	// keys starting with it belong to the group and never move with the data
+	reservedPrefix = "!"
+	peerPrefix     = reservedPrefix + "peer/"
+	// set on forwarded requests so that they are not forwarded twice when
+	// the leader changes in the meantime
+	forwardedHeader = "X-Forwarded-By"
+	leaderHeader    = "X-Leader"
+)
+
+var errUnknownLeader = errors.New("the leader of the group is not known")
+
+// reserved tells if the key is internal to the group
+func reserved(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(reservedPrefix))
+}
+
+// registerPeer records the HTTP address of this node for its raft address,
+// the one the transport advertises since raft.Leader returns that one
+func (s *server) registerPeer() error {
+	_, err := s.apply(&event{
+		OpType: set,
+		Key:    peerPrefix + string(s.localAddr),
+		Value:  []edgeValue{{Value: s.cfg.httpAddr}},
+	})
+	return err
+}
+
+// leaderHTTP returns the HTTP address of the leader of the group
+func (s *server) leaderHTTP() (string, error) {
+	addr := s.raft.Leader()
+	if addr == "" {
+		return "", errUnknownLeader
+	}
+	var vals []edgeValue
+	err := s.fsm.view(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(peerPrefix + string(addr)))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &vals)
+		})
+	})
+	if err == badger.ErrKeyNotFound || (err == nil && len(vals) == 0) {
+		return "", errUnknownLeader
+	}
+	if err != nil {
+		return "", err
+	}
+	return vals[0].Value, nil
+}
+
+// forwardWrite sends the write to the leader when we are not the leader and
+// returns true once the request has been answered
+func (s *httpService) forwardWrite(w http.ResponseWriter, r *http.Request) bool {
+	if s.store.raft.State() == raft.Leader {
+		return false
+	}
+	leader, err := s.store.leaderHTTP()
+	if err != nil {
+		s.fail(w, "Not the leader of the group", err)
+		return true
+	}
+	if !s.forward || r.Header.Get(forwardedHeader) != "" {
+		s.writeError(w, 421, fmt.Sprintf("Not the leader of the group, the leader is %s", leader))
+		return true
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		s.writeError(w, 400, "Could not open request body")
+		return true
+	}
+	url := fmt.Sprintf("http://%s%s", leader, r.URL.RequestURI())
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, url, bytes.NewReader(body))
+	if err != nil {
+		s.writeError(w, 500, "Could not forward the request to the leader")
+		return true
+	}
+	req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	req.Header.Set(forwardedHeader, s.addr)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Info("Could not reach the leader", zap.String("leader", leader), zap.Error(err))
+		s.writeError(w, 503, "Could not reach the leader of the group")
+		return true
+	}
+	defer resp.Body.Close()
+	for _, h := range []string{"Content-Type", leaderHeader} {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		s.logger.Error("Error in writing response", zap.Error(err))
+	}
+	return true
+}
+
+// refuseReserved answers 400 to a write to an id starting with
+// reservedPrefix, such keys are internal and never move with the data
+func (s *httpService) refuseReserved(w http.ResponseWriter, r *http.Request) bool {
+	if !reserved([]byte(mux.Vars(r)["id"])) {
+		return false
+	}
+	s.writeError(w, 400, fmt.Sprintf("The ids starting with %s are reserved", reservedPrefix))
+	return true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	pb "example.com/graphd/cmd/zero/grpc"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	heartbeatInterval = time.Second
+	// counting walks every key so it is not done on every heartbeat
+	keyCountInterval = 10 * time.Second
+)
+
+// heartbeat tells the zero that we are alive every heartbeatInterval, the
+// zero marks us suspect and then dead when the heartbeats stop
+func (s *server) heartbeat(c pb.ZeroClient, node *pb.Node) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	var keys int64
+	var counted time.Time
+	for now := range ticker.C {
+		if now.Sub(counted) >= keyCountInterval {
+			n, err := s.countKeys()
+			if err != nil {
+				s.logger.Error("Could not count the keys", zap.Error(err))
+			} else {
+				keys, counted = n, now
+			}
+		}
+		lsm, vlog := s.fsm.size()
+		req := &pb.HeartbeatRequest{
+			Node:         node,
+			RaftState:    s.raft.State().String(),
+			AppliedIndex: s.raft.AppliedIndex(),
+			DiskUsage:    lsm + vlog,
+			KeyCount:     keys,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), heartbeatInterval)
+		res, err := c.Heartbeat(ctx, req)
+		cancel()
+		if err != nil {
+			s.logger.Info("Could not send heartbeat to zero", zap.Error(err))
+			continue
+		}
+		if res.GetSchemaVersion() != s.schema.getVersion() {
+			if err := s.refreshSchema(c); err != nil {
+				s.logger.Info("Could not fetch the schema", zap.Error(err))
+			}
+		}
+		if s.raft.State() == raft.Leader {
+			if err := s.syncIndexes(); err != nil {
+				s.logger.Error("Could not update the indexes", zap.Error(err))
+			}
+			if err := s.syncCardinality(); err != nil {
+				s.logger.Error("Could not update the cardinality", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *server) countKeys() (int64, error) {
+	var n int64
+	err := s.fsm.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if !reserved(it.Item().Key()) {
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
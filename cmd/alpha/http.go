@@ -14,6 +14,9 @@ type httpService struct {
 	addr   string
 	store  *server
 	logger *zap.Logger
+	// followers pass the writes on to the leader with client
+	forward bool
+	client  *http.Client
 }
 
 func (s *httpService) handleKeyGet(w http.ResponseWriter, r *http.Request) {
@@ -21,84 +24,102 @@ func (s *httpService) handleKeyGet(w http.ResponseWriter, r *http.Request) {
 	// key, err := strconv.ParseUint(vars["id"], 10, 64)
 	key := vars["id"]
 	relation := vars["relation"]
-	// if err != nil {
-	// 	http.Error(w, "Wrong key", 400)
-	// 	return
-	// }
-	value, err := s.store.get(key, relation)
-	if err != nil {
-		http.Error(w, "Could not get the key", 500)
+	level := r.URL.Query().Get("consistency")
+	if level == "" {
+		level = defaultConsistency
+	}
+	if err := s.store.waitReadable(level); err != nil {
+		s.fail(w, "Could not read at the requested consistency", err)
 		return
 	}
-	// valueS := strconv.FormatUint(value, 10)
-	// valueS := [1]string{value}
-	valueM, _ := json.Marshal(value)
-	_, err = w.Write(valueM)
-	// _, err = w.Write([]byte(valueS))
+	value, err := s.store.get(key, relation)
 	if err != nil {
-		http.Error(w, "Error in writing response", 500)
+		s.fail(w, "Could not get the key", err)
 		return
 	}
+	s.writeJSON(w, http.StatusOK, value)
 }
 
 func (s *httpService) handleKeyPut(w http.ResponseWriter, r *http.Request) {
+	if s.refuseReserved(w, r) || s.forwardWrite(w, r) {
+		return
+	}
 	vars := mux.Vars(r)
 	// key, err := strconv.ParseUint(vars["id"], 10, 64)
 	key := vars["id"]
 	relation := vars["relation"]
-	// if err != nil {
-	// 	http.Error(w, "Wrong key", 400)
-	// 	return
-	// }
 	b, err := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 	if err != nil {
-		http.Error(w, "Could not open request body", 500)
+		s.writeError(w, 400, "Could not open request body")
 		return
 	}
 	type message struct {
-		Value string `json:"value"`
+		Value  string                 `json:"value"`
+		Facets map[string]interface{} `json:"facets"`
 	}
 	var msg message
 	err = json.Unmarshal(b, &msg)
 	if err != nil {
-		http.Error(w, "Could not parse Request body", 400)
+		s.writeError(w, 400, "Could not parse Request body")
 		return
 	}
-	value := msg.Value
-	err = s.store.put(key, relation, value)
-	if err != nil {
-		http.Error(w, "Could not put the key", 500)
+	if msg.Value == "" {
+		s.writeError(w, 400, "The value is missing")
+		return
+	}
+	if err := checkFacets(msg.Facets); err != nil {
+		s.writeError(w, 400, "Could not parse the facets: "+err.Error())
 		return
 	}
-	// valueS := strconv.FormatUint(value, 10)
-	valueS := value
-	_, err = w.Write([]byte(valueS))
+	if p := s.store.schema.get(relation); p != nil {
+		if msg.Value, err = checkValue(p.GetType(), msg.Value); err != nil {
+			s.writeError(w, 400, fmt.Sprintf("The value does not fit the %s type of %s: %s", p.GetType(), relation, err))
+			return
+		}
+	}
+	index, err := s.store.put(key, relation, msg.Value, msg.Facets)
 	if err != nil {
-		http.Error(w, "Error in writing response", 500)
+		s.fail(w, "Could not put the key", err)
 		return
 	}
+	s.writeJSON(w, http.StatusOK, &writeResult{Index: index})
 }
 
+// handleKeyDelete serves DELETE /{id}/{relation} which drops the relation,
+// DELETE /{id}/{relation}/{value} which removes a single value and
+// DELETE /{id} which drops every relation of the key stored on this group
 func (s *httpService) handleKeyDelete(w http.ResponseWriter, r *http.Request) {
-	// TODO
+	if s.refuseReserved(w, r) || s.forwardWrite(w, r) {
+		return
+	}
 	vars := mux.Vars(r)
-	// key, err := strconv.ParseUint(vars["id"], 10, 64)
 	key := vars["id"]
-	// if err != nil {
-	// 	http.Error(w, "Wrong key", 400)
-	// 	return
-	// }
-	err := s.store.delete(key)
-	if err != nil {
-		http.Error(w, "Could not delete the key", 500)
-		return
+	relation, hasRelation := vars["relation"]
+	value, hasValue := vars["value"]
+	var index uint64
+	var err error
+	switch {
+	case hasValue:
+		vals := []string{value}
+		// the value is stored in the canonical form of the type, or as it
+		// came when it was written before the schema
+		if p := s.store.schema.get(relation); p != nil {
+			if v, err := checkValue(p.GetType(), value); err == nil && v != value {
+				vals = append(vals, v)
+			}
+		}
+		index, err = s.store.removeValue(key, relation, vals...)
+	case hasRelation:
+		index, err = s.store.delete(key, relation)
+	default:
+		index, err = s.store.deleteNode(key)
 	}
-	_, err = w.Write([]byte("0"))
 	if err != nil {
-		http.Error(w, "Error in writing response", 500)
+		s.fail(w, "Could not delete the key", err)
 		return
 	}
+	s.writeJSON(w, http.StatusOK, &writeResult{Index: index})
 }
 
 func (s *httpService) handleJoin(w http.ResponseWriter, r *http.Request) {
@@ -106,7 +127,7 @@ func (s *httpService) handleJoin(w http.ResponseWriter, r *http.Request) {
 	b, err := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 	if err != nil {
-		http.Error(w, "Could not open request body", 500)
+		s.writeError(w, 400, "Could not open request body")
 		return
 	}
 	type message struct {
@@ -121,8 +142,32 @@ func (s *httpService) handleJoin(w http.ResponseWriter, r *http.Request) {
 	fmt.Println(string(b))
 	err = s.store.join(msg.Addr, msg.Id)
 	if err != nil {
-		s.logger.Info("The node could not join")
-		http.Error(w, "The requesting node could not join", 500)
+		s.fail(w, "The requesting node could not join", err)
+		return
+	}
+}
+
+// handleRemove is called by the zero to take a node out of the group
+func (s *httpService) handleRemove(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		s.writeError(w, 400, "Could not open request body")
+		return
+	}
+	type message struct {
+		Id string `json:"id"`
+	}
+	var msg message
+	err = json.Unmarshal(b, &msg)
+	if err != nil || msg.Id == "" {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	s.logger.Info("Removing node from the group", zap.String("id", msg.Id))
+	err = s.store.remove(msg.Id)
+	if err != nil {
+		s.fail(w, "Could not remove the node", err)
 		return
 	}
 }
@@ -131,9 +176,20 @@ func (s *httpService) Start() {
 	s.logger.Info("Server Starting", zap.String("address", s.addr))
 	r := mux.NewRouter()
 	r.HandleFunc("/join", s.handleJoin).Methods("POST")
+	r.HandleFunc("/remove", s.handleRemove).Methods("POST")
+	r.HandleFunc("/admin/export", s.handleExport).Methods("POST")
+	r.HandleFunc("/admin/import", s.handleImport).Methods("POST")
+	r.HandleFunc("/admin/purge", s.handlePurge).Methods("POST")
+	r.HandleFunc("/admin/edges", s.handleEdges).Methods("POST")
+	r.HandleFunc("/admin/freeze", s.handleFreeze).Methods("POST")
+	r.HandleFunc("/admin/thaw", s.handleThaw).Methods("POST")
+	r.HandleFunc("/batch", s.handleBatch).Methods("POST")
+	r.HandleFunc("/search", s.handleSearch).Methods("POST")
 	r.HandleFunc("/{id}/{relation}", s.handleKeyGet).Methods("GET")
 	r.HandleFunc("/{id}/{relation}", s.handleKeyPut).Methods("PUT")
 	r.HandleFunc("/{id}/{relation}", s.handleKeyDelete).Methods("DELETE")
+	r.HandleFunc("/{id}/{relation}/{value}", s.handleKeyDelete).Methods("DELETE")
+	r.HandleFunc("/{id}", s.handleKeyDelete).Methods("DELETE")
 	http.Handle("/", r)
 	srv := http.Server{
 		Handler: r,
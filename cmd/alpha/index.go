@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"github.com/dgraph-io/badger/v3"
+	"go.uber.org/zap"
+)
+
+// The values of a relation whose schema names tokenizers are indexed by this
+// group, for the keys it holds. Each token of a value is a key of its own,
+//
+//	!idx/<relation> 0 <tokenizer> 0 <token> 0 <id>
+//
+// with 0 a zero byte, so the nodes having a token are read with a prefix
+// scan. The tokenizers a relation is indexed with are kept under
+// !idxschema/<relation> and written through the log like the data, the FSM
+// reads them to update the entries in the transaction writing the values.
+// The leader compares them to the schema on every heartbeat and proposes a
+// reindex of the relations whose indexes changed.
+//
+//	exact    the whole value
+//	term     the lower case words of the value
+//	fulltext the words without the stop words, stemmed
+//
+// Badger caps the keys at 65000 bytes, a token of maxToken bytes or more is
+// cut and ends with the sha256 of the whole token instead. The cut tokens are
+// all maxToken long and the others shorter, so they never match each other.
+
+const (
+	indexPrefix       = reservedPrefix + "idx/"
+	indexSchemaPrefix = reservedPrefix + "idxschema/"
+	indexSeparator    = "\x00"
+	maxToken          = 512
+)
+
+var errNoIndex = errors.New("the relation is not indexed for the function")
+
+// stopWords are left out of the fulltext index
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be but by for if in
+		into is it no not of on or such that the their then there these they
+		this to was will with`) {
+		stopWords[w] = true
+	}
+}
+
+// words splits the text on what is not a letter or a digit, in lower case
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// capToken cuts a long token to maxToken bytes, the end is its hash
+func capToken(t string) string {
+	if len(t) < maxToken {
+		return t
+	}
+	sum := sha256.Sum256([]byte(t))
+	h := hex.EncodeToString(sum[:])
+	return t[:maxToken-len(h)] + h
+}
+
+// tokens returns the tokens of the value for the tokenizer, once each
+func tokens(tokenizer, value string) []string {
+	var out []string
+	switch tokenizer {
+	case "exact":
+		return []string{capToken(value)}
+	case "term":
+		for _, w := range words(value) {
+			out = append(out, capToken(w))
+		}
+	case "fulltext":
+		for _, w := range words(value) {
+			if !stopWords[w] {
+				out = append(out, capToken(stem(w)))
+			}
+		}
+	}
+	sort.Strings(out)
+	n := 0
+	for i, t := range out {
+		if i == 0 || t != out[n-1] {
+			out[n] = t
+			n++
+		}
+	}
+	return out[:n]
+}
+
+func tokenPrefix(relation, tokenizer, token string) []byte {
+	return []byte(indexPrefix + relation + indexSeparator + tokenizer + indexSeparator + token + indexSeparator)
+}
+
+// indexedKey returns the id%relation key an index entry points to, nil for
+// the other keys
+func indexedKey(key []byte) []byte {
+	if !bytes.HasPrefix(key, []byte(indexPrefix)) {
+		return nil
+	}
+	rest := key[len(indexPrefix):]
+	i := bytes.Index(rest, []byte(indexSeparator))
+	j := bytes.LastIndex(rest, []byte(indexSeparator))
+	if i < 0 || j <= i {
+		return nil
+	}
+	return []byte(string(rest[j+1:]) + SEPARATOR + string(rest[:i]))
+}
+
+// withIndex extends a match on the keys to their index entries
+func withIndex(match func(key []byte) bool) func(key []byte) bool {
+	return func(key []byte) bool {
+		if k := indexedKey(key); k != nil {
+			return match(k)
+		}
+		return match(key)
+	}
+}
+
+// indexes returns the tokenizers the relation is indexed with
+func indexes(txn *badger.Txn, relation string) ([]string, error) {
+	item, err := txn.Get([]byte(indexSchemaPrefix + relation))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &out)
+	})
+	return out, err
+}
+
+// indexEntries returns the index keys of the values of a key
+func indexEntries(tokenizers []string, id, relation string, vals []edgeValue) map[string]bool {
+	out := make(map[string]bool)
+	for _, tokenizer := range tokenizers {
+		for _, v := range vals {
+			for _, t := range tokens(tokenizer, v.Value) {
+				out[string(tokenPrefix(relation, tokenizer, t))+id] = true
+			}
+		}
+	}
+	return out
+}
+
+// reindexKey updates the index entries of the key once its values went from
+// prev to next, in the transaction that writes them
+func reindexKey(txn *badger.Txn, key []byte, prev, next []edgeValue) error {
+	if reserved(key) {
+		return nil
+	}
+	i := bytes.Index(key, []byte(SEPARATOR))
+	if i < 0 {
+		return nil
+	}
+	id, relation := string(key[:i]), string(key[i+len(SEPARATOR):])
+	tokenizers, err := indexes(txn, relation)
+	if err != nil || len(tokenizers) == 0 {
+		return err
+	}
+	before := indexEntries(tokenizers, id, relation, prev)
+	after := indexEntries(tokenizers, id, relation, next)
+	for k := range before {
+		if !after[k] {
+			if err := txn.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+	}
+	for k := range after {
+		if !before[k] {
+			if err := txn.Set([]byte(k), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reindex rebuilds the entries of the relation for the tokenizers, none
+// drops its index
+func (f *raftFSM) reindex(relation string, tokenizers []string) error {
+	prefix := []byte(indexPrefix + relation + indexSeparator)
+	err := f.deleteMatching(func(key []byte) bool {
+		return bytes.HasPrefix(key, prefix)
+	})
+	if err != nil {
+		return err
+	}
+	wb := f.db.NewWriteBatch()
+	defer wb.Cancel()
+	if len(tokenizers) == 0 {
+		if err := wb.Delete([]byte(indexSchemaPrefix + relation)); err != nil {
+			return err
+		}
+		return wb.Flush()
+	}
+	b, err := json.Marshal(tokenizers)
+	if err != nil {
+		return err
+	}
+	if err := wb.Set([]byte(indexSchemaPrefix+relation), b); err != nil {
+		return err
+	}
+	err = f.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := item.Key()
+			if reserved(key) || relationOf(key) != relation {
+				continue
+			}
+			id := string(key[:len(key)-len(SEPARATOR)-len(relation)])
+			var vals []edgeValue
+			err := item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &vals)
+			})
+			if err != nil {
+				return err
+			}
+			for k := range indexEntries(tokenizers, id, relation, vals) {
+				if err := wb.Set([]byte(k), nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return wb.Flush()
+}
+
+// syncIndexes proposes a reindex of the relations whose tokenizers in the
+// schema differ from the ones the group indexes with, only the leader does
+func (s *server) syncIndexes() error {
+	if !s.schema.isLoaded() {
+		// without the schema every index would look dropped
+		return nil
+	}
+	want := s.schema.indexes()
+	have := make(map[string][]string)
+	err := s.fsm.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(indexSchemaPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var tokenizers []string
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &tokenizers)
+			})
+			if err != nil {
+				return err
+			}
+			have[string(it.Item().Key()[len(indexSchemaPrefix):])] = tokenizers
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for relation := range have {
+		if _, ok := want[relation]; !ok {
+			want[relation] = nil
+		}
+	}
+	for relation, tokenizers := range want {
+		if strings.Join(tokenizers, ",") == strings.Join(have[relation], ",") {
+			continue
+		}
+		s.logger.Info("Reindexing", zap.String("relation", relation), zap.Strings("index", tokenizers))
+		if _, err := s.apply(&event{OpType: idx, Relation: relation, Index: tokenizers}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// search returns the ids whose values in the relation have any or all the
+// tokens of the text, sorted
+func (s *server) search(relation, fn, text string) ([]string, error) {
+	sf, ok := pb.SearchFuncs[fn]
+	if !ok {
+		return nil, fmt.Errorf("unknown search function %q", fn)
+	}
+	toks := tokens(sf.Tokenizer, text)
+	if len(toks) == 0 {
+		return []string{}, nil
+	}
+	counts := make(map[string]int)
+	err := s.fsm.view(func(txn *badger.Txn) error {
+		tokenizers, err := indexes(txn, relation)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, t := range tokenizers {
+			found = found || t == sf.Tokenizer
+		}
+		if !found {
+			return fmt.Errorf("%w, %s has no %s index", errNoIndex, relation, sf.Tokenizer)
+		}
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		for _, t := range toks {
+			prefix := tokenPrefix(relation, sf.Tokenizer, t)
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				counts[string(it.Item().Key()[len(prefix):])]++
+			}
+			it.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(counts))
+	for id, n := range counts {
+		if !sf.All || n == len(toks) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+type searchRequest struct {
+	Relation string `json:"relation"`
+	Func     string `json:"func"`
+	Text     string `json:"text"`
+}
+
+type searchResult struct {
+	Ids []string `json:"ids"`
+}
+
+// handleSearch serves POST /search, the zero sends it to every group holding
+// keys of the relation. It takes ?consistency= like a GET.
+//
+//	{"relation": "name", "func": "anyofterms", "text": "alice bob"}
+func (s *httpService) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if _, ok := pb.SearchFuncs[req.Func]; !ok {
+		s.writeError(w, 400, "The function should be eq, anyofterms, allofterms, anyoftext or alloftext")
+		return
+	}
+	level := r.URL.Query().Get("consistency")
+	if level == "" {
+		level = defaultConsistency
+	}
+	if err := s.store.waitReadable(level); err != nil {
+		s.fail(w, "Could not read at the requested consistency", err)
+		return
+	}
+	ids, err := s.store.search(req.Relation, req.Func, req.Text)
+	if errors.Is(err, errNoIndex) {
+		s.writeError(w, 400, "Could not search: "+err.Error())
+		return
+	}
+	if err != nil {
+		s.fail(w, "Could not search", err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, &searchResult{Ids: ids})
+}
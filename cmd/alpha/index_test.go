@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		tokenizer, value string
+		want             []string
+	}{
+		{"exact", "Alice Smith", []string{"Alice Smith"}},
+		{"exact", "", []string{""}},
+		{"term", "Alice Smith, alice-SMITH 2", []string{"2", "alice", "smith"}},
+		{"term", " ,. ", nil},
+		{"fulltext", "The connected nodes and the connections of a graph", []string{"connect", "graph", "node"}},
+		{"fulltext", "the and of", nil},
+		{"unknown", "alice", nil},
+	}
+	for _, tt := range tests {
+		if got := tokens(tt.tokenizer, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokens(%s, %q) = %q, want %q", tt.tokenizer, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLongTokens(t *testing.T) {
+	short := strings.Repeat("a", maxToken-1)
+	if got := tokens("exact", short); got[0] != short {
+		t.Errorf("a token shorter than maxToken was cut to %d bytes", len(got[0]))
+	}
+	long := strings.Repeat("a", 70000)
+	seen := make(map[string]string)
+	for _, v := range []string{strings.Repeat("a", maxToken), long, long + "b", "b" + long} {
+		for _, tokenizer := range []string{"exact", "term", "fulltext"} {
+			toks := tokens(tokenizer, v)
+			if len(toks) != 1 || len(toks[0]) != maxToken {
+				t.Fatalf("tokens(%s) of %d bytes gives %d tokens of %d bytes", tokenizer, len(v), len(toks), len(toks[0]))
+			}
+			if toks[0] != tokens(tokenizer, v)[0] {
+				t.Errorf("the %s token of %d bytes changes", tokenizer, len(v))
+			}
+			if tokenizer == "exact" {
+				if other, ok := seen[toks[0]]; ok {
+					t.Errorf("values of %d and %d bytes have the same token", len(other), len(v))
+				}
+				seen[toks[0]] = v
+			}
+		}
+	}
+}
+
+func TestIndexEntries(t *testing.T) {
+	got := indexEntries([]string{"exact", "term"}, "alice", "name", strs("Alice Smith", "alice"))
+	want := map[string]bool{
+		"!idx/name\x00exact\x00Alice Smith\x00alice": true,
+		"!idx/name\x00exact\x00alice\x00alice":       true,
+		"!idx/name\x00term\x00alice\x00alice":        true,
+		"!idx/name\x00term\x00smith\x00alice":        true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for k := range want {
+		if key := indexedKey([]byte(k)); string(key) != "alice"+SEPARATOR+"name" {
+			t.Errorf("%q points to %q", k, key)
+		}
+	}
+}
+
+// indexKeys returns the index entries of the relation
+func indexKeys(t *testing.T, f *raftFSM, relation string) map[string]bool {
+	t.Helper()
+	out := make(map[string]bool)
+	err := f.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(indexPrefix + relation + indexSeparator)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			out[string(it.Item().Key())] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestReindexKey(t *testing.T) {
+	f := newTestFSM(t)
+	applyEvent(t, f, &event{OpType: add, Key: "bob%name", Value: strs("Bob Smith")})
+	applyEvent(t, f, &event{OpType: idx, Relation: "name", Index: []string{"term"}})
+	applyEvent(t, f, &event{OpType: add, Key: "alice%name", Value: strs("Alice Smith", "Alice")})
+	applyEvent(t, f, &event{OpType: add, Key: "alice%city", Value: strs("Paris")})
+	steps := []struct {
+		e    *event
+		want []string
+	}{
+		{nil, []string{"term\x00alice\x00alice", "term\x00smith\x00alice", "term\x00bob\x00bob", "term\x00smith\x00bob"}},
+		// alice stays with the other value having it
+		{&event{OpType: rem, Key: "alice%name", Value: strs("Alice Smith")}, []string{"term\x00alice\x00alice", "term\x00bob\x00bob", "term\x00smith\x00bob"}},
+		{&event{OpType: del, Key: "bob%name"}, []string{"term\x00alice\x00alice"}},
+		{&event{OpType: mrg, Batch: map[string][]edgeValue{"carol%name": strs("Carol")}}, []string{"term\x00alice\x00alice", "term\x00carol\x00carol"}},
+		{&event{OpType: dal, Key: "alice"}, []string{"term\x00carol\x00carol"}},
+		{&event{OpType: idx, Relation: "name", Index: []string{"exact"}}, []string{"exact\x00Carol\x00carol"}},
+		{&event{OpType: idx, Relation: "name"}, nil},
+	}
+	for i, step := range steps {
+		if step.e != nil {
+			applyEvent(t, f, step.e)
+		}
+		want := make(map[string]bool)
+		for _, k := range step.want {
+			want[indexPrefix+"name"+indexSeparator+k] = true
+		}
+		if got := indexKeys(t, f, "name"); !reflect.DeepEqual(got, want) {
+			t.Errorf("step %d: got %v, want %v", i, got, want)
+		}
+	}
+	if got := indexKeys(t, f, "city"); len(got) != 0 {
+		t.Errorf("the relation without index has entries %v", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	f := newTestFSM(t)
+	s := &server{fsm: f}
+	long := strings.Repeat("a very long name ", 5000)
+	for id, name := range map[string]string{
+		"alice": "Alice Smith",
+		"bob":   "Bob Smith",
+		"carol": "Alice Jones",
+		"dave":  "The connections",
+		"erin":  long,
+	} {
+		applyEvent(t, f, &event{OpType: add, Key: id + SEPARATOR + "name", Value: strs(name)})
+	}
+	applyEvent(t, f, &event{OpType: idx, Relation: "name", Index: []string{"exact", "term", "fulltext"}})
+	tests := []struct {
+		fn, text string
+		want     []string
+	}{
+		{"eq", "Alice Smith", []string{"alice"}},
+		{"eq", "alice smith", []string{}},
+		{"eq", long, []string{"erin"}},
+		{"eq", long + "!", []string{}},
+		{"anyofterms", "alice smith", []string{"alice", "bob", "carol"}},
+		{"anyofterms", "nobody", []string{}},
+		{"allofterms", "alice smith", []string{"alice"}},
+		{"allofterms", "smith smith alice", []string{"alice"}},
+		{"allofterms", "smith nobody", []string{}},
+		{"allofterms", "smith", []string{"alice", "bob"}},
+		{"anyoftext", "connected graphs", []string{"dave"}},
+		{"alloftext", "the connecting", []string{"dave"}},
+		{"alloftext", "connecting names", []string{}},
+		{"anyoftext", "the of", []string{}},
+	}
+	for _, tt := range tests {
+		got, err := s.search("name", tt.fn, tt.text)
+		if err != nil {
+			t.Fatalf("%s(%.20q): %v", tt.fn, tt.text, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s(%.20q) = %v, want %v", tt.fn, tt.text, got, tt.want)
+		}
+	}
+	if _, err := s.search("city", "eq", "Paris"); !errors.Is(err, errNoIndex) {
+		t.Errorf("searching a relation without index gave %v", err)
+	}
+}
@@ -16,9 +16,15 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -40,6 +46,21 @@ func join(joinAddr, myAddr, id string) error {
 	return nil
 }
 
+// dialZero connects to the zero group, addrs is a comma separated list.
+// Calls are balanced over the zeros that are up, followers forward to the leader.
+func dialZero(addrs string) (*grpc.ClientConn, error) {
+	var state resolver.State
+	for _, addr := range strings.Split(addrs, ",") {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: strings.TrimSpace(addr)})
+	}
+	r := manual.NewBuilderWithScheme("zero")
+	r.InitialState(state)
+	return grpc.Dial(r.Scheme()+":///zero",
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
 func main() {
 	logger, err := zap.NewProduction()
 	if err != nil {
@@ -51,57 +72,64 @@ func main() {
 	id := flag.String("id", "", "Id of the cluster")
 	httpAddr := flag.String("haddr", "localhost:8000", "Set the address for the HTTP server")
 	raftAddr := flag.String("raddr", "localhost:9000", "Set the address for the Raft")
-	masterAddr := flag.String("master", "localhost:10000", "The address of the master")
-	isLeader := flag.Bool("leader", false, "is the current node a raft leader (used for bootstrapping)")
+	masterAddr := flag.String("master", "localhost:10000", "Comma separated GRPC addresses of the zeros")
+	isLeader := flag.Bool("leader", false, "start a new group led by this node instead of joining one")
+	forward := flag.Bool("forward", true, "pass the writes sent to a follower on to the leader, otherwise answer 421 with the leader address")
+	zone := flag.String("zone", "", "Zone the node runs in, the replicas of a group are spread over zones and racks")
+	rack := flag.String("rack", "", "Rack the node runs in")
+	leave := flag.Bool("leave", false, "leave the group when shutting down, the node can not come back with its data")
 
 	flag.Parse()
 
-	con, err := grpc.Dial(*masterAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	con, err := dialZero(*masterAddr)
 	if err != nil {
 		logger.Error("Could not connect to Master", zap.Error(err))
 	}
 	defer con.Close()
 	c := pb.NewZeroClient(con)
 
-	cfg := config{
-		id:     *id,
-		path:   "./build/data/" + *id,
-		addr:   *raftAddr,
-		leader: *isLeader,
-	}
-
-	srv, err := newServer(&cfg, logger)
-	if err != nil {
-		logger.Fatal("Could not start raft server, try deleting the data directory")
-		return
-	}
-
 	node := pb.Node{
 		Id:          *id,
 		GroupId:     "",
 		RaftAddress: *raftAddr,
 		HttpAddress: *httpAddr,
+		Zone:        *zone,
+		Rack:        *rack,
 	}
 
+	// ask the zero where we belong first, it starts a new group with us as
+	// the leader when every group is full
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	var r *pb.Group
 	if *isLeader {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		r, err := c.CreateAGroup(ctx, &node)
-		if err != nil {
-			logger.Fatal("Could not contact master, try restarting")
-			return
-		}
-		node.GroupId = r.GetId()
+		r, err = c.CreateAGroup(ctx, &node)
 	} else {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		r, err := c.JoinAGroup(ctx, &node)
-		if err != nil {
-			logger.Fatal("Could not contact master, try restarting")
-			return
-		}
+		r, err = c.JoinAGroup(ctx, &node)
+	}
+	cancel()
+	if err != nil {
+		logger.Fatal("Could not contact master, try restarting", zap.Error(err))
+		return
+	}
+	node.GroupId = r.GetId()
+	bootstrap := r.GetLeaderRaftAddress() == *raftAddr
+
+	cfg := config{
+		id:       *id,
+		path:     "./build/data/" + *id,
+		addr:     *raftAddr,
+		httpAddr: *httpAddr,
+		leader:   bootstrap,
+	}
+
+	srv, err := newServer(&cfg, logger)
+	if err != nil {
+		logger.Fatal("Could not start raft server, try deleting the data directory")
+		return
+	}
+
+	if !bootstrap {
 		joinAddr := r.GetLeaderHttpAddress()
-		node.GroupId = r.GetId()
 		// If I am not the first one then join them
 		_, err = net.ResolveTCPAddr("tcp", joinAddr)
 		if err != nil {
@@ -115,24 +143,59 @@ func main() {
 		}
 	}
 
+	// tell the zero every time we become the leader so that it can route to us
 	go func() {
-		leaderChange := <-srv.raft.LeaderCh()
-		log.Println("Sending leader change req")
-		if leaderChange {
+		for leaderChange := range srv.raft.LeaderCh() {
+			if !leaderChange {
+				continue
+			}
+			log.Println("Sending leader change req")
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
 			_, err := c.UpdateLeader(ctx, &node)
+			cancel()
 			if err != nil {
-				log.Fatal(err)
+				logger.Error("Could not update the leader on zero", zap.Error(err))
 			}
+			// the followers look us up to forward the writes
+			if err := srv.registerPeer(); err != nil {
+				logger.Error("Could not record the address of the leader", zap.Error(err))
+			}
+		}
+	}()
+
+	// the writes are checked against the schema, the heartbeats tell when it changes
+	if err := srv.refreshSchema(c); err != nil {
+		logger.Error("Could not fetch the schema", zap.Error(err))
+	}
+	go srv.heartbeat(c, &node)
+
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		<-sigs
+		if *leave {
+			logger.Info("Leaving the group")
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			_, err := c.RemoveNode(ctx, &node)
+			cancel()
+			if err != nil {
+				logger.Error("Could not leave the group", zap.Error(err))
+			}
+		}
+		if err := srv.raft.Shutdown().Error(); err != nil {
+			logger.Error("Could not shutdown raft", zap.Error(err))
 		}
+		srv.db.Close()
+		os.Exit(0)
 	}()
 
 	httpsrv := &httpService{
-		addr:   *httpAddr,
-		store:  srv,
-		logger: logger,
+		addr:    *httpAddr,
+		store:   srv,
+		logger:  logger,
+		forward: *forward,
+		client:  &http.Client{Timeout: raftTimeout},
 	}
-	logger.Info(fmt.Sprintf("Running Node: %d at addr: %s, %s", *id, *httpAddr, *raftAddr))
+	logger.Info(fmt.Sprintf("Running Node: %s at addr: %s, %s", *id, *httpAddr, *raftAddr))
 	httpsrv.Start()
 }
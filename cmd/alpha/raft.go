@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"io"
+	"sort"
+	"sync"
 
 	"github.com/dgraph-io/badger/v3"
+	bpb "github.com/dgraph-io/badger/v3/pb"
 	"github.com/hashicorp/raft"
 	"go.uber.org/zap"
 	// "strconv"
@@ -14,19 +20,65 @@ import (
 type raftFSM struct {
 	db     *badger.DB
 	logger *zap.Logger
+	// Restore drops the store before loading the snapshot, it holds mu while
+	// the reads made outside of the FSM share it
+	mu sync.RWMutex
+}
+
+// view reads the store, not while a snapshot is being restored
+func (f *raftFSM) view(fn func(txn *badger.Txn) error) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.db.View(fn)
+}
+
+// size returns the size of the LSM tree and of the value log
+func (f *raftFSM) size() (int64, int64) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.db.Size()
 }
 
+const (
+	// the number of keys per KVList in a snapshot
+	snapshotBatch = 1000
+	// how many batches badger Load writes at once when restoring
+	snapshotPendingWrites = 256
+)
+
 const (
 	set string = "SET"
 	upd string = "UPD"
 	del string = "DEL"
+	add string = "ADD" // add values to the list of a key, each value is kept once, or replace it for a single value relation
+	rem string = "REM" // remove values from the list of a key
+	dal string = "DAL" // delete every relation of a node, the key is the id
+	mrg string = "MRG" // write a batch of keys into the store, used when data moves between groups
+	prg string = "PRG" // purge the keys that moved to another group
+	idx string = "IDX" // rebuild the index entries of a relation for new tokenizers
+	frz string = "FRZ" // refuse the writes to the keys moving to another group
+	thw string = "THW" // accept them again once they moved
+	crd string = "CRD" // set whether a relation holds a single value
+	edt string = "EDT" // remove then add values of many keys, the zero updates the reverse lists this way
 )
 
 type event struct {
-	OpType   string   `json:"opType"`
-	Key      string   `json:"key"`
-	Relation string   `json:"relation"`
-	Value    []string `json:"value"`
+	OpType   string      `json:"opType"`
+	Key      string      `json:"key"`
+	Relation string      `json:"relation"`
+	Value    []edgeValue `json:"value"`
+	// key -> values for a merge or the values an edit adds
+	Batch map[string][]edgeValue `json:"batch,omitempty"`
+	// key -> the values an edit removes
+	Remove map[string][]string `json:"remove,omitempty"`
+	// the keys to purge or freeze, see partitionRequest
+	Partitions     []int    `json:"partitions,omitempty"`
+	PartitionCount int      `json:"partitionCount,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	// the tokenizers of a reindex
+	Index []string `json:"index,omitempty"`
+	// the cardinality of the relation
+	Single bool `json:"single,omitempty"`
 }
 
 func (e *event) key() []byte {
@@ -67,9 +119,110 @@ func (f *raftFSM) Apply(log *raft.Log) interface{} {
 		}
 		// should read only operations go through raft?
 	case del:
+		err := f.update(e.key(), func(cur []edgeValue) []edgeValue {
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	case add:
+		single, err := f.single(relationOf(e.key()))
+		if err != nil {
+			return err
+		}
+		err = f.update(e.key(), func(cur []edgeValue) []edgeValue {
+			if single {
+				return replaceValues(cur, e.Value)
+			}
+			return addValues(cur, e.Value)
+		})
+		if err != nil {
+			return err
+		}
+	case rem:
+		err := f.update(e.key(), func(cur []edgeValue) []edgeValue {
+			drop := make(map[string]bool, len(e.Value))
+			for _, v := range e.Value {
+				drop[v.Value] = true
+			}
+			kept := cur[:0]
+			for _, v := range cur {
+				if !drop[v.Value] {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == 0 {
+				// the last value is gone, so is the key
+				return nil
+			}
+			return kept
+		})
+		if err != nil {
+			return err
+		}
+	case dal:
+		prefix := []byte(e.Key + SEPARATOR)
+		if err := f.checkFrozen(prefix); err != nil {
+			return err
+		}
+		err := f.deleteMatching(withIndex(func(key []byte) bool {
+			return bytes.HasPrefix(key, prefix)
+		}))
+		if err != nil {
+			return err
+		}
+	case mrg:
+		if err := f.merge(e.Batch); err != nil {
+			return err
+		}
+	case edt:
+		if err := f.edit(e.Remove, e.Batch); err != nil {
+			return err
+		}
+	case prg:
+		req := partitionRequest{
+			Partitions:     e.Partitions,
+			PartitionCount: e.PartitionCount,
+			Relation:       e.Relation,
+			Exclude:        e.Exclude,
+		}
+		if err := f.purge(&req); err != nil {
+			return err
+		}
+	case idx:
+		if err := f.reindex(e.Relation, e.Index); err != nil {
+			return err
+		}
+	case frz:
+		req := partitionRequest{
+			Partitions:     e.Partitions,
+			PartitionCount: e.PartitionCount,
+			Relation:       e.Relation,
+			Exclude:        e.Exclude,
+		}
+		b, err := json.Marshal(&req)
+		if err != nil {
+			return err
+		}
+		err = f.db.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(frozenKey), b)
+		})
+		if err != nil {
+			return err
+		}
+	case thw:
 		err := f.db.Update(func(txn *badger.Txn) error {
-			err := txn.Delete(e.key())
+			return txn.Delete([]byte(frozenKey))
+		})
+		if err != nil {
 			return err
+		}
+	case crd:
+		err := f.db.Update(func(txn *badger.Txn) error {
+			if e.Single {
+				return txn.Set([]byte(singlePrefix+e.Relation), nil)
+			}
+			return txn.Delete([]byte(singlePrefix + e.Relation))
 		})
 		if err != nil {
 			return err
@@ -80,6 +233,191 @@ func (f *raftFSM) Apply(log *raft.Log) interface{} {
 	return nil
 }
 
+// update reads the list of the key and writes back what fn makes of it in
+// the same transaction, the read happens here rather than in the handler so
+// that concurrent writes to a key do not overwrite each other and every
+// replica ends up with the same list. A nil list deletes the key. The index
+// entries of the values change in the same transaction.
+func (f *raftFSM) update(key []byte, fn func(cur []edgeValue) []edgeValue) error {
+	return f.db.Update(func(txn *badger.Txn) error {
+		var cur []edgeValue
+		item, err := txn.Get(key)
+		if err == nil {
+			err = item.Value(func(val []byte) error {
+				return json.Unmarshal(val, &cur)
+			})
+		}
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		match, err := frozenMatcher(txn)
+		if err != nil {
+			return err
+		}
+		if match != nil && match(key) {
+			return errFrozen
+		}
+		next := fn(append([]edgeValue(nil), cur...))
+		if err := reindexKey(txn, key, cur, next); err != nil {
+			return err
+		}
+		if next == nil {
+			return txn.Delete(key)
+		}
+		b, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, b)
+	})
+}
+
+// frozenMatcher selects the keys moving to another group, nil when none is
+func frozenMatcher(txn *badger.Txn) (func(key []byte) bool, error) {
+	item, err := txn.Get([]byte(frozenKey))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var req partitionRequest
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &req)
+	}); err != nil {
+		return nil, err
+	}
+	return req.matcher(), nil
+}
+
+// checkFrozen refuses a write to the keys with the prefix when one of them
+// is moving
+func (f *raftFSM) checkFrozen(prefix []byte) error {
+	return f.db.View(func(txn *badger.Txn) error {
+		match, err := frozenMatcher(txn)
+		if err != nil || match == nil {
+			return err
+		}
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if match(it.Item().Key()) {
+				return errFrozen
+			}
+		}
+		return nil
+	})
+}
+
+// merge writes the keys of the batch as they are on the group they come
+// from, the zero purged them here before copying them
+func (f *raftFSM) merge(batch map[string][]edgeValue) error {
+	return f.db.Update(func(txn *badger.Txn) error {
+		for key, vals := range batch {
+			var cur []edgeValue
+			item, err := txn.Get([]byte(key))
+			if err == nil {
+				err = item.Value(func(val []byte) error {
+					return json.Unmarshal(val, &cur)
+				})
+			}
+			if err != nil && err != badger.ErrKeyNotFound {
+				return err
+			}
+			if err := reindexKey(txn, []byte(key), cur, vals); err != nil {
+				return err
+			}
+			b, err := json.Marshal(vals)
+			if err != nil {
+				return err
+			}
+			if err := txn.Set([]byte(key), b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// edit removes values from keys and then adds values to keys, a value in
+// both is set with exactly the facets it comes with. The keys are done in
+// order so a frozen key stops every replica at the same place.
+func (f *raftFSM) edit(remove map[string][]string, add map[string][]edgeValue) error {
+	keys := make([]string, 0, len(remove)+len(add))
+	for k := range remove {
+		keys = append(keys, k)
+	}
+	for k := range add {
+		if _, ok := remove[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		err := f.update([]byte(k), func(cur []edgeValue) []edgeValue {
+			drop := make(map[string]bool, len(remove[k]))
+			for _, v := range remove[k] {
+				drop[v] = true
+			}
+			kept := cur[:0]
+			for _, v := range cur {
+				if !drop[v.Value] {
+					kept = append(kept, v)
+				}
+			}
+			next := addValues(kept, add[k])
+			if len(next) == 0 {
+				return nil
+			}
+			return next
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purge deletes every key selected by the request, every replica holds the
+// same keys at this point of the log so the result is the same
+func (f *raftFSM) purge(req *partitionRequest) error {
+	if !req.valid() {
+		return errors.New("refusing to purge every key")
+	}
+	return f.deleteMatching(withIndex(req.matcher()))
+}
+
+// deleteMatching deletes every key match selects
+func (f *raftFSM) deleteMatching(match func(key []byte) bool) error {
+	var keys [][]byte
+	err := f.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if match(it.Item().Key()) {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	wb := f.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range keys {
+		if err := wb.Delete(key); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
 // Snapshot returns an FSMSnapshot used to: support log compaction, to
 // restore the FSM to a previous state, or to bring out-of-date followers up
 // to a recent log index.
@@ -93,31 +431,92 @@ func (f *raftFSM) Apply(log *raft.Log) interface{} {
 // be called concurrently with FSMSnapshot.Persist. This means the FSM should
 // be implemented to allow for concurrent updates while a snapshot is happening.
 func (f *raftFSM) Snapshot() (raft.FSMSnapshot, error) {
-	return &raftFSMSnapshot{}, nil
+	// the read transaction pins the store as of the last applied entry,
+	// Persist reads from it while Apply keeps writing. A Restore waits for
+	// the Release.
+	f.mu.RLock()
+	return &raftFSMSnapshot{txn: f.db.NewTransaction(false), mu: &f.mu}, nil
 }
 
 // Restore is used to restore an FSM from a snapshot. It is not called
 // concurrently with any other command. The FSM must discard all previous
 // state before restoring the snapshot.
-func (*raftFSM) Restore(io.ReadCloser) error {
-	return nil
+func (f *raftFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.db.DropAll(); err != nil {
+		return err
+	}
+	return f.db.Load(rc, snapshotPendingWrites)
 }
 
 // FSMSnapshot is returned by an FSM in response to a Snapshot
 // It must be safe to invoke FSMSnapshot methods with concurrent calls to Apply.
 type raftFSMSnapshot struct {
+	txn *badger.Txn
+	mu  *sync.RWMutex
 }
 
 // Persist should dump all necessary state to the WriteCloser 'sink',
 // and call sink.Close() when finished or call sink.Cancel() on error.
-func (*raftFSMSnapshot) Persist(sink raft.SnapshotSink) error {
-	// Persist and Restore functions are related
-	// raft persists the snapshot periodically
-	// in case of complete failure the state is restored from disk
-	// from the last time we Persisted, we don't need that since badger handles the persistence for us
-	return nil
+func (s *raftFSMSnapshot) Persist(sink raft.SnapshotSink) error {
+	// raft compacts its log once the snapshot is taken, so the snapshot is
+	// the only way for a node joining later to get the older keys
+	if err := s.write(sink); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+// write dumps the store in the format of badger backups, a little endian
+// uint64 length followed by a KVList, so that Restore can use badger Load
+func (s *raftFSMSnapshot) write(w io.Writer) error {
+	list := &bpb.KVList{}
+	flush := func() error {
+		if len(list.Kv) == 0 {
+			return nil
+		}
+		b, err := list.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, uint64(len(b))); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		list.Kv = list.Kv[:0]
+		return nil
+	}
+	it := s.txn.NewIterator(badger.DefaultIteratorOptions)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		list.Kv = append(list.Kv, &bpb.KV{
+			Key:       item.KeyCopy(nil),
+			Value:     val,
+			UserMeta:  []byte{item.UserMeta()},
+			Version:   item.Version(),
+			ExpiresAt: item.ExpiresAt(),
+		})
+		if len(list.Kv) >= snapshotBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
 }
 
 // Release is invoked when we are finished with the snapshot.
-func (*raftFSMSnapshot) Release() {
+func (s *raftFSMSnapshot) Release() {
+	s.txn.Discard()
+	s.mu.RUnlock()
 }
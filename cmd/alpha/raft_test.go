@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+)
+
+type testNode struct {
+	raft      *raft.Raft
+	fsm       *raftFSM
+	transport *raft.InmemTransport
+}
+
+// newTestNode starts a raft node over an in memory badger and transport,
+// keeping a single entry of the log past each snapshot
+func newTestNode(t *testing.T, id string) *testNode {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	cfg := raft.DefaultConfig()
+	cfg.LocalID = raft.ServerID(id)
+	cfg.HeartbeatTimeout = 50 * time.Millisecond
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+	cfg.CommitTimeout = 5 * time.Millisecond
+	cfg.SnapshotThreshold = 10
+	cfg.TrailingLogs = 1
+	cfg.LogOutput = io.Discard
+	_, transport := raft.NewInmemTransport(raft.ServerAddress(id))
+	fsm := &raftFSM{db: db, logger: zap.NewNop()}
+	store := raft.NewInmemStore()
+	r, err := raft.NewRaft(cfg, fsm, store, store, raft.NewInmemSnapshotStore(), transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Shutdown().Error() })
+	return &testNode{raft: r, fsm: fsm, transport: transport}
+}
+
+// keys returns the keys of the node with their values
+func (n *testNode) keys(t *testing.T) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	err := n.fsm.view(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			val, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			out[string(it.Item().Key())] = string(val)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestJoinAfterCompaction(t *testing.T) {
+	leader := newTestNode(t, "a1")
+	err := leader.raft.BootstrapCluster(raft.Configuration{Servers: []raft.Server{{
+		ID:      "a1",
+		Address: leader.transport.LocalAddr(),
+	}}}).Error()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-leader.raft.LeaderCh():
+	case <-time.After(5 * time.Second):
+		t.Fatal("a1 did not become the leader")
+	}
+
+	const count = 100
+	for i := 0; i < count; i++ {
+		b, err := json.Marshal(&event{
+			OpType: add,
+			Key:    fmt.Sprintf("n%d%sname", i, SEPARATOR),
+			Value:  []edgeValue{{Value: fmt.Sprintf("v%d", i)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := leader.raft.Apply(b, time.Second)
+		if err := f.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if err, ok := f.Response().(error); ok {
+			t.Fatal(err)
+		}
+	}
+	if err := leader.raft.Snapshot().Error(); err != nil {
+		t.Fatal(err)
+	}
+	if leader.raft.Stats()["last_snapshot_index"] == "0" {
+		t.Fatal("the log was not compacted")
+	}
+	want := leader.keys(t)
+	if len(want) != count {
+		t.Fatalf("the leader holds %d keys, want %d", len(want), count)
+	}
+
+	joiner := newTestNode(t, "a2")
+	leader.transport.Connect(joiner.transport.LocalAddr(), joiner.transport)
+	joiner.transport.Connect(leader.transport.LocalAddr(), leader.transport)
+	if err := leader.raft.AddVoter("a2", joiner.transport.LocalAddr(), 0, 0).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := joiner.keys(t)
+		if len(got) == len(want) {
+			for k, v := range want {
+				if got[k] != v {
+					t.Fatalf("a2 holds %q for %s, want %q", got[k], k, v)
+				}
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("a2 holds %d keys, want %d", len(got), len(want))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if joiner.raft.Stats()["last_snapshot_index"] == "0" {
+		t.Fatal("a2 caught up without installing the snapshot")
+	}
+}
+
+// newTestFSM returns a FSM over an in memory badger, the tests apply the
+// events to it without a raft
+func newTestFSM(t *testing.T) *raftFSM {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &raftFSM{db: db, logger: zap.NewNop()}
+}
+
+// applyEvent applies the event as a committed log entry would be
+func applyEvent(t *testing.T, f *raftFSM, e *event) {
+	t.Helper()
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err, ok := f.Apply(&raft.Log{Data: b}).(error); ok {
+		t.Fatalf("%s %s: %v", e.OpType, e.Key, err)
+	}
+}
+
+// valuesOf returns the list of the key, nil when it is not there
+func valuesOf(t *testing.T, f *raftFSM, key string) []edgeValue {
+	t.Helper()
+	var out []edgeValue
+	err := f.view(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &out)
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// strs makes the values without facets
+func strs(vals ...string) []edgeValue {
+	out := make([]edgeValue, len(vals))
+	for i, v := range vals {
+		out[i] = edgeValue{Value: v}
+	}
+	return out
+}
+
+func TestApplyAddRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []*event
+		want   []edgeValue
+	}{
+		{
+			"add",
+			[]*event{{OpType: add, Value: strs("bob")}, {OpType: add, Value: strs("carol", "dave")}},
+			strs("bob", "carol", "dave"),
+		},
+		{
+			"add keeps each value once",
+			[]*event{{OpType: add, Value: strs("bob", "carol")}, {OpType: add, Value: strs("carol", "bob", "dave", "dave")}},
+			strs("bob", "carol", "dave"),
+		},
+		{
+			"remove",
+			[]*event{{OpType: add, Value: strs("bob", "carol", "dave")}, {OpType: rem, Value: strs("carol", "erin")}},
+			strs("bob", "dave"),
+		},
+		{
+			"remove then add",
+			[]*event{{OpType: add, Value: strs("bob", "carol")}, {OpType: rem, Value: strs("bob")}, {OpType: add, Value: strs("bob")}},
+			strs("carol", "bob"),
+		},
+		{
+			"remove from nothing",
+			[]*event{{OpType: rem, Value: strs("bob")}},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newTestFSM(t)
+			for _, e := range tt.events {
+				e.Key = "alice" + SEPARATOR + "friend"
+				applyEvent(t, f, e)
+			}
+			if got := valuesOf(t, f, "alice"+SEPARATOR+"friend"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMerge(t *testing.T) {
+	f := newTestFSM(t)
+	applyEvent(t, f, &event{OpType: add, Key: "alice" + SEPARATOR + "friend", Value: strs("bob")})
+	applyEvent(t, f, &event{OpType: mrg, Batch: map[string][]edgeValue{
+		"alice" + SEPARATOR + "friend": strs("carol"),
+		"bob" + SEPARATOR + "friend":   strs("alice", "carol"),
+	}})
+	want := map[string][]edgeValue{
+		"alice" + SEPARATOR + "friend": strs("carol"),
+		"bob" + SEPARATOR + "friend":   strs("alice", "carol"),
+	}
+	for key, vals := range want {
+		if got := valuesOf(t, f, key); !reflect.DeepEqual(got, vals) {
+			t.Errorf("%s holds %v, want %v", key, got, vals)
+		}
+	}
+}
+
+func TestApplyDelete(t *testing.T) {
+	f := newTestFSM(t)
+	for _, key := range []string{"alice%friend", "alice%name", "alicia%name", "bob%friend", "bob%name"} {
+		applyEvent(t, f, &event{OpType: add, Key: key, Value: strs("x", "y")})
+	}
+	applyEvent(t, f, &event{OpType: rem, Key: "bob%friend", Value: strs("x", "y")})
+	applyEvent(t, f, &event{OpType: del, Key: "bob%name"})
+	applyEvent(t, f, &event{OpType: dal, Key: "alice"})
+	for _, key := range []string{"alice%friend", "alice%name", "bob%friend", "bob%name"} {
+		if got := valuesOf(t, f, key); got != nil {
+			t.Errorf("%s still holds %v", key, got)
+		}
+	}
+	if got := valuesOf(t, f, "alicia%name"); !reflect.DeepEqual(got, strs("x", "y")) {
+		t.Errorf("deleting alice left alicia with %v", got)
+	}
+}
+
+func TestApplyEdit(t *testing.T) {
+	f := newTestFSM(t)
+	applyEvent(t, f, &event{OpType: add, Key: "bob%~friend", Value: strs("alice", "carol")})
+	applyEvent(t, f, &event{OpType: add, Key: "dave%~friend", Value: strs("alice")})
+	edit := &event{
+		OpType: edt,
+		Remove: map[string][]string{
+			"bob%~friend":  {"alice", "carol"},
+			"dave%~friend": {"alice"},
+			"erin%~friend": {"alice"},
+		},
+		Batch: map[string][]edgeValue{
+			"bob%~friend":  strs("alice"),
+			"erin%~friend": strs("alice"),
+		},
+	}
+	// the reverser runs a task again until it is done, the edit has to
+	// leave the same lists
+	applyEvent(t, f, edit)
+	applyEvent(t, f, edit)
+	want := map[string][]edgeValue{
+		"bob%~friend":  strs("alice"),
+		"dave%~friend": nil,
+		"erin%~friend": strs("alice"),
+	}
+	for key, vals := range want {
+		if got := valuesOf(t, f, key); !reflect.DeepEqual(got, vals) {
+			t.Errorf("%s holds %v, want %v", key, got, vals)
+		}
+	}
+}
+
+func TestApplyFacets(t *testing.T) {
+	f := newTestFSM(t)
+	key := "alice" + SEPARATOR + "friend"
+	applyEvent(t, f, &event{OpType: add, Key: key, Value: []edgeValue{
+		{Value: "bob", Facets: map[string]interface{}{"since": "2019", "close": true}},
+		{Value: "carol"},
+	}})
+	applyEvent(t, f, &event{OpType: add, Key: key, Value: []edgeValue{
+		{Value: "bob", Facets: map[string]interface{}{"since": "2021"}},
+		{Value: "carol", Facets: map[string]interface{}{"weight": 2.0}},
+		{Value: "dave"},
+	}})
+	want := []edgeValue{
+		{Value: "bob", Facets: map[string]interface{}{"since": "2021"}},
+		{Value: "carol", Facets: map[string]interface{}{"weight": 2.0}},
+		{Value: "dave"},
+	}
+	if got := valuesOf(t, f, key); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestApplySingle(t *testing.T) {
+	f := newTestFSM(t)
+	key := "alice" + SEPARATOR + "city"
+	applyEvent(t, f, &event{OpType: add, Key: key, Value: strs("rome", "paris")})
+	applyEvent(t, f, &event{OpType: crd, Relation: "city", Single: true})
+	applyEvent(t, f, &event{OpType: add, Key: key, Value: strs("paris")})
+	if got := valuesOf(t, f, key); !reflect.DeepEqual(got, strs("paris")) {
+		t.Errorf("a single value relation holds %v, want [paris]", got)
+	}
+	applyEvent(t, f, &event{OpType: add, Key: key, Value: strs("oslo")})
+	if got := valuesOf(t, f, key); !reflect.DeepEqual(got, strs("oslo")) {
+		t.Errorf("a single value relation holds %v, want [oslo]", got)
+	}
+	applyEvent(t, f, &event{OpType: crd, Relation: "city"})
+	applyEvent(t, f, &event{OpType: add, Key: key, Value: strs("rome")})
+	if got := valuesOf(t, f, key); !reflect.DeepEqual(got, strs("oslo", "rome")) {
+		t.Errorf("a list relation holds %v, want [oslo rome]", got)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"github.com/dgraph-io/badger/v3"
+	"go.uber.org/zap"
+)
+
+// The zero keeps the schema of the relations, the type of their values and
+// how many values they hold. We keep a copy to check the writes against,
+// fetched when we start and again whenever the version the heartbeats return
+// changes, so a change reaches us within a heartbeat or so. A relation the
+// schema does not know takes any value, as many as are written.
+//
+// A put to a relation holding a single value replaces the one it had. The
+// replicas must agree on which relations those are when they apply a put, so
+// the leader writes them through the log under !single/<relation> once it
+// sees them in the schema and the FSM reads them there.
+
+const (
+	cardinalityOne = "one"
+	singlePrefix   = reservedPrefix + "single/"
+	schemaTimeout  = 5 * time.Second
+	// the datetimes are accepted as a date alone
+	dateLayout = "2006-01-02"
+)
+
+type schemaCache struct {
+	mut        sync.RWMutex
+	loaded     bool
+	version    uint64
+	predicates map[string]*pb.Predicate
+}
+
+// get returns the schema of the relation, nil when it has none
+func (c *schemaCache) get(relation string) *pb.Predicate {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.predicates[relation]
+}
+
+func (c *schemaCache) getVersion() uint64 {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.version
+}
+
+// isLoaded tells if the schema was fetched from the zero
+func (c *schemaCache) isLoaded() bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	return c.loaded
+}
+
+// indexes returns the tokenizers of the indexed relations
+func (c *schemaCache) indexes() map[string][]string {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	out := make(map[string][]string)
+	for relation, p := range c.predicates {
+		if len(p.GetIndex()) > 0 {
+			out[relation] = p.GetIndex()
+		}
+	}
+	return out
+}
+
+// singles returns the relations holding a single value
+func (c *schemaCache) singles() map[string]bool {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	out := make(map[string]bool)
+	for relation, p := range c.predicates {
+		if p.GetCardinality() == cardinalityOne {
+			out[relation] = true
+		}
+	}
+	return out
+}
+
+func (c *schemaCache) set(s *pb.Schema) {
+	predicates := make(map[string]*pb.Predicate, len(s.GetPredicates()))
+	for _, p := range s.GetPredicates() {
+		predicates[p.GetRelation()] = p
+	}
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.loaded, c.version, c.predicates = true, s.GetVersion(), predicates
+}
+
+// refreshSchema fetches the schema from the zero
+func (s *server) refreshSchema(c pb.ZeroClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), schemaTimeout)
+	defer cancel()
+	res, err := c.GetSchema(ctx, &pb.SchemaRequest{})
+	if err != nil {
+		return err
+	}
+	s.schema.set(res)
+	return nil
+}
+
+// single tells if the relation holds a single value, as written through
+// the log
+func (f *raftFSM) single(relation string) (bool, error) {
+	found := false
+	err := f.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(singlePrefix + relation))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		found = err == nil
+		return err
+	})
+	return found, err
+}
+
+// syncCardinality proposes the relations whose cardinality in the schema
+// differs from the one written through the log, only the leader does
+func (s *server) syncCardinality() error {
+	if !s.schema.isLoaded() {
+		// without the schema every relation would look like holding many
+		return nil
+	}
+	want := s.schema.singles()
+	have := make(map[string]bool)
+	err := s.fsm.view(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(singlePrefix)
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			have[string(it.Item().Key()[len(singlePrefix):])] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for relation := range have {
+		if !want[relation] {
+			want[relation] = false
+		}
+	}
+	for relation, single := range want {
+		if single == have[relation] {
+			continue
+		}
+		s.logger.Info("Changing the cardinality", zap.String("relation", relation), zap.Bool("single", single))
+		if _, err := s.apply(&event{OpType: crd, Relation: relation, Single: single}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkValue returns the value in the canonical form of the type, so that
+// 07 and 7 are the same int, or an error when it is not of the type
+func checkValue(typ, v string) (string, error) {
+	switch typ {
+	case "int":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an int", v)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case "float":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("%q is not a float", v)
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	case "bool":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a bool", v)
+		}
+		return strconv.FormatBool(b), nil
+	case "datetime":
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			if t, err = time.Parse(dateLayout, v); err != nil {
+				return "", fmt.Errorf("%q is not a RFC 3339 datetime or a date", v)
+			}
+		}
+		return t.UTC().Format(time.RFC3339Nano), nil
+	case "geo":
+		parts := strings.Split(v, ",")
+		if len(parts) != 2 {
+			return "", fmt.Errorf("%q is not a latitude,longitude point", v)
+		}
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		lon, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err1 != nil || err2 != nil || math.IsNaN(lat) || math.IsNaN(lon) || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+			return "", fmt.Errorf("%q is not a latitude,longitude point", v)
+		}
+		return strconv.FormatFloat(lat, 'f', -1, 64) + "," + strconv.FormatFloat(lon, 'f', -1, 64), nil
+	}
+	// default, uid and string take any value
+	return v, nil
+}
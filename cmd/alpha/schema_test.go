@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestCheckValue(t *testing.T) {
+	tests := []struct {
+		typ, value string
+		want       string
+		ok         bool
+	}{
+		{"int", "07", "7", true},
+		{"int", "-12", "-12", true},
+		{"int", "1.5", "", false},
+		{"float", "1.50", "1.5", true},
+		{"float", "NaN", "", false},
+		{"float", "-Inf", "", false},
+		{"bool", "t", "true", true},
+		{"bool", "yes", "", false},
+		{"datetime", "2006-01-02", "2006-01-02T00:00:00Z", true},
+		{"datetime", "2006-01-02T15:04:05+02:00", "2006-01-02T13:04:05Z", true},
+		{"datetime", "yesterday", "", false},
+		{"geo", "48.850, 2.35", "48.85,2.35", true},
+		{"geo", "-90,180", "-90,180", true},
+		{"geo", "91,0", "", false},
+		{"geo", "0,-181", "", false},
+		{"geo", "NaN,0", "", false},
+		{"geo", "0,nan", "", false},
+		{"geo", "Inf,0", "", false},
+		{"geo", "0,-Inf", "", false},
+		{"geo", "48.85", "", false},
+		{"string", " 07 ", " 07 ", true},
+		{"uid", "alice", "alice", true},
+	}
+	for _, tt := range tests {
+		got, err := checkValue(tt.typ, tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("checkValue(%s, %q) = %q, %v, want %q", tt.typ, tt.value, got, err, tt.want)
+		}
+	}
+}
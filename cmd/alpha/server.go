@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 
 	// "strconv"
-	"time"
 
 	"github.com/dgraph-io/badger/v3"
 	"github.com/hashicorp/raft"
@@ -17,10 +16,11 @@ import (
 )
 
 type config struct {
-	id     string
-	path   string
-	addr   string
-	leader bool
+	id       string
+	path     string
+	addr     string
+	httpAddr string
+	leader   bool
 }
 
 // The full server encapsulated in a struct
@@ -30,16 +30,20 @@ type server struct {
 	raft   *raft.Raft  // the raft
 	fsm    *raftFSM    // the fsm
 	db     *badger.DB
+	// the raft address the transport advertises to the other nodes
+	localAddr raft.ServerAddress
+	// the copy of the schema kept by the zero
+	schema *schemaCache
 }
 
 var SEPARATOR string = "%"
 
-func (s *server) get(key, relation string) ([]string, error) {
+func (s *server) get(key, relation string) ([]edgeValue, error) {
 	// keyS := strconv.FormatUint(key, 10)
 	keyS := key + SEPARATOR + relation
-	var valS []string
+	var valS []edgeValue
 
-	err := s.db.View(func(txn *badger.Txn) error {
+	err := s.fsm.view(func(txn *badger.Txn) error {
 		item, err := txn.Get([]byte(keyS))
 		if err != nil {
 			s.logger.Info("Key not available")
@@ -57,54 +61,41 @@ func (s *server) get(key, relation string) ([]string, error) {
 		return err
 	})
 	if err != nil {
-		return []string{}, err
+		return []edgeValue{}, err
 	}
 	return valS, err
 }
 
-func (s *server) put(key, relation, val string) error {
-	vals, _ := s.get(key, relation)
-
-	data := event{
-		OpType: "SET",
+// put adds the value to the relation of the key, the FSM replaces what it
+// holds when the relation holds a single value. The FSM changes the list so
+// concurrent puts on a key do not lose values. Putting a value again with
+// facets sets the facets of its edge.
+func (s *server) put(key, relation, val string, facets map[string]interface{}) (uint64, error) {
+	return s.apply(&event{
+		OpType: add,
 		Key:    key + SEPARATOR + relation,
-		Value:  append(vals, val),
-	}
-
-	dataJson, err := json.Marshal(data)
-
-	if err != nil {
-		s.logger.Error("Could not marshal data")
-	}
-
-	applyFuture := s.raft.Apply(dataJson, 500*time.Millisecond)
-	if err := applyFuture.Error(); err != nil {
-		s.logger.Error("Could not apply put method", zap.Error(err))
-	}
-
-	return nil
+		Value:  []edgeValue{{Value: val, Facets: facets}},
+	})
 }
 
-func (s *server) delete(key string) error {
-	// TODO
-
-	data := event{
-		OpType: "SET",
-		Key:    key,
-		Value:  []string{"0"},
+// removeValue drops every occurrence of the values from the relation of the key
+func (s *server) removeValue(key, relation string, vals ...string) (uint64, error) {
+	e := &event{OpType: rem, Key: key + SEPARATOR + relation}
+	for _, v := range vals {
+		e.Value = append(e.Value, edgeValue{Value: v})
 	}
+	return s.apply(e)
+}
 
-	dataJson, err := json.Marshal(data)
-
-	if err != nil {
-		s.logger.Error("Could not marshal data")
-	}
+// delete removes the relation of the key with all its values
+func (s *server) delete(key, relation string) (uint64, error) {
+	return s.apply(&event{OpType: del, Key: key + SEPARATOR + relation})
+}
 
-	applyFuture := s.raft.Apply(dataJson, 500*time.Millisecond)
-	if err := applyFuture.Error(); err != nil {
-		s.logger.Error("Could not apply put method", zap.Error(err))
-	}
-	return nil
+// deleteNode removes every relation of the key held by this group, the
+// other groups hold the rest
+func (s *server) deleteNode(key string) (uint64, error) {
+	return s.apply(&event{OpType: dal, Key: key})
 }
 
 // respond to join requests by a node at joinAddr
@@ -137,11 +128,26 @@ func (s *server) join(joinAddr, id string) error {
 	return nil
 }
 
+// remove takes the node out of the raft configuration, only the leader can
+// do this, the leader can remove itself in which case it steps down
+func (s *server) remove(id string) error {
+	if s.raft.State() != raft.Leader {
+		return raft.ErrNotLeader
+	}
+	future := s.raft.RemoveServer(raft.ServerID(id), 0, 0)
+	return future.Error()
+}
+
 func newServer(cfg *config, logger *zap.Logger) (*server, error) {
 	db, err := badger.Open(badger.DefaultOptions(filepath.Join(cfg.path, "data")))
 	if err != nil {
 		logger.Fatal("Could not open connection to badger db", zap.Error(err))
 	}
+	// the store is rebuilt from the raft snapshot and log when raft starts,
+	// keeping what is on disk would apply the appends a second time
+	if err := db.DropAll(); err != nil {
+		return nil, err
+	}
 
 	raftConfig := raft.DefaultConfig()
 	raftConfig.LocalID = raft.ServerID(cfg.id)
@@ -180,11 +186,13 @@ func newServer(cfg *config, logger *zap.Logger) (*server, error) {
 		rf.BootstrapCluster(config)
 	}
 	srv := &server{
-		logger: logger,
-		raft:   rf,
-		fsm:    &fsm,
-		db:     db,
-		cfg:    cfg,
+		logger:    logger,
+		raft:      rf,
+		fsm:       &fsm,
+		db:        db,
+		cfg:       cfg,
+		localAddr: transport.LocalAddr(),
+		schema:    &schemaCache{},
 	}
 	return srv, nil
 }
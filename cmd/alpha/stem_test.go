@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word, want string
+	}{
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"ties", "ti"},
+		{"caress", "caress"},
+		{"cats", "cat"},
+		{"feed", "feed"},
+		{"agreed", "agre"},
+		{"plastered", "plaster"},
+		{"bled", "bled"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"conflated", "conflat"},
+		{"troubled", "troubl"},
+		{"sized", "size"},
+		{"hopping", "hop"},
+		{"falling", "fall"},
+		{"hissing", "hiss"},
+		{"filing", "file"},
+		{"happy", "happi"},
+		{"sky", "sky"},
+		{"relational", "relat"},
+		{"conditional", "condit"},
+		{"digitizer", "digit"},
+		{"predication", "predic"},
+		{"operator", "oper"},
+		{"feudalism", "feudal"},
+		{"hopefulness", "hope"},
+		{"sensitiviti", "sensit"},
+		{"triplicate", "triplic"},
+		{"formalize", "formal"},
+		{"electrical", "electr"},
+		{"goodness", "good"},
+		{"allowance", "allow"},
+		{"adjustable", "adjust"},
+		{"replacement", "replac"},
+		{"adoption", "adopt"},
+		{"communism", "commun"},
+		{"effective", "effect"},
+		{"probate", "probat"},
+		{"rate", "rate"},
+		{"controll", "control"},
+		{"roll", "roll"},
+		{"connect", "connect"},
+		{"connected", "connect"},
+		{"connecting", "connect"},
+		{"connections", "connect"},
+		{"is", "is"},
+		{"café", "café"},
+		{"r2d2", "r2d2"},
+	}
+	for _, tt := range tests {
+		if got := stem(tt.word); got != tt.want {
+			t.Errorf("stem(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
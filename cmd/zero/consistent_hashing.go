@@ -1,13 +1,24 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	pb "example.com/graphd/cmd/zero/grpc"
 	"github.com/boltdb/bolt"
 	"github.com/buraksezer/consistent"
 	"github.com/cespare/xxhash/v2"
 )
 
 var (
-	groups = []byte("Groups")
+	errNoGroups = errors.New("there are no groups on the ring")
+
+	groups  = []byte("Groups")
+	nodes   = []byte("Nodes")
+	tablets = []byte("Tablets")
+	// the options of the relations
+	predicates = []byte("Predicates")
+	// the reverse lists left to update
+	reverseTasks = []byte("ReverseTasks")
 )
 
 // In your code, you probably have a custom data type
@@ -30,8 +41,9 @@ func (h hasher) Sum64(data []byte) uint64 {
 
 // maps the key value to the group id, should be persistent right?
 type consistentHashHandler struct {
-	c  *consistent.Consistent
-	db *bolt.DB
+	c   *consistent.Consistent
+	cfg consistent.Config
+	db  *bolt.DB
 }
 
 func newConsistentHashHandler(db *bolt.DB) (*consistentHashHandler, error) {
@@ -52,48 +64,256 @@ func newConsistentHashHandler(db *bolt.DB) (*consistentHashHandler, error) {
 	defer tx.Rollback()
 
 	// Create all the buckets
-	if _, err := tx.CreateBucketIfNotExists(groups); err != nil {
+	for _, name := range [][]byte{groups, nodes, tablets, predicates, reverseTasks} {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
-	tx.Commit()
 
 	return &consistentHashHandler{
-		c:  c,
-		db: db,
+		c:   c,
+		cfg: cfg,
+		db:  db,
 	}, nil
 }
 
-func (ch *consistentHashHandler) addGroup(id string) error {
+// addGroup puts the group on the ring and persists its record
+func (ch *consistentHashHandler) addGroup(id string, rec *groupRecord) error {
 	ch.c.Add(group(id))
+	return ch.saveGroup(id, rec)
+}
+
+func (ch *consistentHashHandler) removeGroup(id string) error {
+	ch.c.Remove(id)
 	txn, err := ch.db.Begin(true)
 	if err != nil {
 		return err
 	}
 	defer txn.Rollback()
 	bucket := txn.Bucket(groups)
-	if err := bucket.Put([]byte(id), []byte("")); err != nil {
+	if err := bucket.Delete([]byte(id)); err != nil {
 		return err
 	}
-	txn.Commit()
-	return nil
+	return txn.Commit()
 }
 
-func (ch *consistentHashHandler) removeGroup(id string) error {
-	ch.c.Remove(id)
+func put(bucket *bolt.Bucket, id string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(id), b)
+}
+
+// saveGroup persists the record of a group that is already on the ring
+func (ch *consistentHashHandler) saveGroup(id string, rec *groupRecord) error {
+	return ch.db.Update(func(txn *bolt.Tx) error {
+		return put(txn.Bucket(groups), id, rec)
+	})
+}
+
+func (ch *consistentHashHandler) saveNode(node *pb.Node) error {
+	return ch.db.Update(func(txn *bolt.Tx) error {
+		return put(txn.Bucket(nodes), node.GetId(), node)
+	})
+}
+
+func (ch *consistentHashHandler) deleteNode(id string) error {
+	return ch.db.Update(func(txn *bolt.Tx) error {
+		return txn.Bucket(nodes).Delete([]byte(id))
+	})
+}
+
+func (ch *consistentHashHandler) saveTablet(t *tablet) error {
+	return ch.db.Update(func(txn *bolt.Tx) error {
+		if t.Mode == hashMode {
+			return txn.Bucket(tablets).Delete([]byte(t.Relation))
+		}
+		return put(txn.Bucket(tablets), t.Relation, t)
+	})
+}
+
+func (ch *consistentHashHandler) savePredicate(p *predicate) error {
+	return ch.db.Update(func(txn *bolt.Tx) error {
+		if p.isDefault() {
+			return txn.Bucket(predicates).Delete([]byte(p.Relation))
+		}
+		return put(txn.Bucket(predicates), p.Relation, p)
+	})
+}
+
+func (ch *consistentHashHandler) saveReverseTask(t *reverseTask) error {
+	return ch.db.Update(func(txn *bolt.Tx) error {
+		return put(txn.Bucket(reverseTasks), t.Id, t)
+	})
+}
+
+func (ch *consistentHashHandler) deleteReverseTask(id string) error {
+	return ch.db.Update(func(txn *bolt.Tx) error {
+		return txn.Bucket(reverseTasks).Delete([]byte(id))
+	})
+}
+
+// load reads back the groups, nodes, tablets, predicates and reverse tasks and rebuilds the ring from
+// them, the ring only depends on the set of groups so keys map to the same groups
+func (ch *consistentHashHandler) load() (*zeroState, error) {
+	state := &zeroState{
+		Groups:       make(map[string]*groupRecord),
+		Nodes:        make(map[string]*pb.Node),
+		Tablets:      make(map[string]*tablet),
+		Predicates:   make(map[string]*predicate),
+		ReverseTasks: make(map[string]*reverseTask),
+	}
+	err := ch.db.View(func(txn *bolt.Tx) error {
+		err := txn.Bucket(groups).ForEach(func(k, v []byte) error {
+			rec := &groupRecord{}
+			// groups written by older versions have no record
+			if len(v) > 0 {
+				if err := json.Unmarshal(v, rec); err != nil {
+					return err
+				}
+			}
+			state.Groups[string(k)] = rec
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = txn.Bucket(nodes).ForEach(func(k, v []byte) error {
+			node := &pb.Node{}
+			if err := json.Unmarshal(v, node); err != nil {
+				return err
+			}
+			state.Nodes[string(k)] = node
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = txn.Bucket(tablets).ForEach(func(k, v []byte) error {
+			t := &tablet{}
+			if err := json.Unmarshal(v, t); err != nil {
+				return err
+			}
+			state.Tablets[string(k)] = t
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = txn.Bucket(predicates).ForEach(func(k, v []byte) error {
+			p := &predicate{}
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			state.Predicates[string(k)] = p
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return txn.Bucket(reverseTasks).ForEach(func(k, v []byte) error {
+			t := &reverseTask{}
+			if err := json.Unmarshal(v, t); err != nil {
+				return err
+			}
+			state.ReverseTasks[string(k)] = t
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for id, rec := range state.Groups {
+		if !rec.Pending {
+			ch.c.Add(group(id))
+		}
+	}
+	return state, nil
+}
+
+// reset replaces everything with the given state, used when restoring a snapshot
+func (ch *consistentHashHandler) reset(state *zeroState) error {
+	for _, m := range ch.c.GetMembers() {
+		ch.c.Remove(m.String())
+	}
 	txn, err := ch.db.Begin(true)
 	if err != nil {
 		return err
 	}
 	defer txn.Rollback()
-	bucket := txn.Bucket(groups)
-	if err := bucket.Delete([]byte(id)); err != nil {
-		return err
+	for _, name := range [][]byte{groups, nodes, tablets, predicates, reverseTasks} {
+		if err := txn.DeleteBucket(name); err != nil {
+			return err
+		}
+		if _, err := txn.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	for id, rec := range state.Groups {
+		if !rec.Pending {
+			ch.c.Add(group(id))
+		}
+		if err := put(txn.Bucket(groups), id, rec); err != nil {
+			return err
+		}
+	}
+	for id, node := range state.Nodes {
+		if err := put(txn.Bucket(nodes), id, node); err != nil {
+			return err
+		}
+	}
+	for relation, t := range state.Tablets {
+		if err := put(txn.Bucket(tablets), relation, t); err != nil {
+			return err
+		}
+	}
+	for relation, p := range state.Predicates {
+		if err := put(txn.Bucket(predicates), relation, p); err != nil {
+			return err
+		}
+	}
+	for id, t := range state.ReverseTasks {
+		if err := put(txn.Bucket(reverseTasks), id, t); err != nil {
+			return err
+		}
 	}
-	txn.Commit()
-	return nil
+	return txn.Commit()
+}
+
+// ownerChange is a partition going from a group to another
+type ownerChange struct {
+	from, to string
+}
+
+// partitionMoves returns the partitions that change owner when the group is
+// added to the ring. The load of the groups is bounded so some partitions
+// also move between the groups already there, they are keyed by their
+// current and next owner.
+func (ch *consistentHashHandler) partitionMoves(id string) map[ownerChange][]int {
+	members := append(ch.c.GetMembers(), group(id))
+	next := consistent.New(members, ch.cfg)
+	moves := make(map[ownerChange][]int)
+	for part := 0; part < ch.cfg.PartitionCount; part++ {
+		from := ch.c.GetPartitionOwner(part)
+		if from == nil {
+			continue
+		}
+		if to := next.GetPartitionOwner(part).String(); to != from.String() {
+			c := ownerChange{from: from.String(), to: to}
+			moves[c] = append(moves[c], part)
+		}
+	}
+	return moves
 }
 
 func (ch *consistentHashHandler) getGroupForKey(key string) (string, error) {
 	grp := ch.c.LocateKey([]byte(key))
+	if grp == nil {
+		return "", errNoGroups
+	}
 	return grp.String(), nil
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	pb "example.com/graphd/cmd/zero/grpc"
+)
+
+// The edges of a relation can carry facets, typed properties stored with the
+// edge by the alphas, the format they are written in is shared with them.
+// A facet is a string, a number or a boolean. Queries filter the edges on
+// their facets and order the values by one of them.
+
+// edgeValue is a value of a relation with the facets of its edge
+type (
+	edgeValue  = pb.EdgeValue
+	edgeObject = pb.EdgeObject
+)
+
+// valueStrings drops the facets
+func valueStrings(vals []edgeValue) []string {
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		out[i] = v.Value
+	}
+	return out
+}
+
+// compareFacets orders two facets of the same type, ok is false when the
+// types differ
+func compareFacets(a, b interface{}) (cmp int, ok bool) {
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+// evalFacets tells if the facets of an edge pass a facet filter
+func (e *filterExpr) evalFacets(facets map[string]interface{}) bool {
+	switch e.Op {
+	case "and":
+		return e.Args[0].evalFacets(facets) && e.Args[1].evalFacets(facets)
+	case "or":
+		return e.Args[0].evalFacets(facets) || e.Args[1].evalFacets(facets)
+	case "not":
+		return !e.Args[0].evalFacets(facets)
+	}
+	f, ok := facets[e.Relation]
+	if e.Op == "has" || !ok {
+		return ok
+	}
+	cmp, ok := compareFacets(f, e.Literal)
+	if !ok {
+		return false
+	}
+	switch e.Op {
+	case "eq":
+		return cmp == 0
+	case "lt":
+		return cmp < 0
+	case "le":
+		return cmp <= 0
+	case "gt":
+		return cmp > 0
+	case "ge":
+		return cmp >= 0
+	}
+	return false
+}
+
+// lessFacet orders two edges by a facet, the edges without it go last
+func lessFacet(a, b edgeValue, facet string, desc bool) bool {
+	fa, oka := a.Facets[facet]
+	fb, okb := b.Facets[facet]
+	if !oka || !okb {
+		return oka && !okb
+	}
+	cmp, ok := compareFacets(fa, fb)
+	if !ok {
+		return false
+	}
+	if desc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
@@ -0,0 +1,46 @@
+package zeroGrpc
+
+import (
+	"encoding/json"
+)
+
+// An edge can carry facets, typed properties such as the date a friendship
+// started or a weight. A value with facets is written as an object and one
+// without as a plain string, so the lists written before facets existed,
+// and the raft log entries and snapshots holding them, read the same. The
+// alphas store the values in this format and the zero reads and writes them
+// the same way.
+//
+//	["bob", {"value": "carol", "facets": {"since": "2019-04-01", "weight": 2, "close": true}}]
+
+// EdgeValue is a value of a relation with the facets of its edge
+type EdgeValue struct {
+	Value  string
+	Facets map[string]interface{}
+}
+
+// EdgeObject is an EdgeValue written with its facets
+type EdgeObject struct {
+	Value  string                 `json:"value"`
+	Facets map[string]interface{} `json:"facets,omitempty"`
+}
+
+func (v EdgeValue) MarshalJSON() ([]byte, error) {
+	if len(v.Facets) == 0 {
+		return json.Marshal(v.Value)
+	}
+	return json.Marshal(&EdgeObject{Value: v.Value, Facets: v.Facets})
+}
+
+func (v *EdgeValue) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		v.Facets = nil
+		return json.Unmarshal(b, &v.Value)
+	}
+	var o EdgeObject
+	if err := json.Unmarshal(b, &o); err != nil {
+		return err
+	}
+	v.Value, v.Facets = o.Value, o.Facets
+	return nil
+}
@@ -0,0 +1,8 @@
+package zeroGrpc
+
+// The limits the zero and the alphas agree on, next to the messages they
+// exchange.
+
+// MaxBatchKeys is the most keys a batched read on an alpha takes, the zero
+// splits its reads in batches of at most that many keys
+const MaxBatchKeys = 10000
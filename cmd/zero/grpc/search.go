@@ -0,0 +1,19 @@
+package zeroGrpc
+
+// SearchFunc is a search function of the zero, run by the alphas on the
+// index of its tokenizer
+type SearchFunc struct {
+	Tokenizer string
+	// a node needs all the tokens of the text, not any of them
+	All bool
+}
+
+// SearchFuncs are the search functions by name, the zero checks the queries
+// and the schema against them and the alphas run them
+var SearchFuncs = map[string]SearchFunc{
+	"eq":         {"exact", true},
+	"anyofterms": {"term", false},
+	"allofterms": {"term", true},
+	"anyoftext":  {"fulltext", false},
+	"alloftext":  {"fulltext", true},
+}
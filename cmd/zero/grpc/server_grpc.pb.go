@@ -26,6 +26,14 @@ type ZeroClient interface {
 	CreateAGroup(ctx context.Context, in *Node, opts ...grpc.CallOption) (*Group, error)
 	UpdateLeader(ctx context.Context, in *Node, opts ...grpc.CallOption) (*Group, error)
 	GetLeader(ctx context.Context, in *Group, opts ...grpc.CallOption) (*Node, error)
+	// streams every group once and then each change as it is applied
+	WatchGroups(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Zero_WatchGroupsClient, error)
+	// alphas report that they are alive every heartbeat interval
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	// removes the node from its group, including the raft configuration of the group
+	RemoveNode(ctx context.Context, in *Node, opts ...grpc.CallOption) (*Group, error)
+	// the schema of the relations, alphas fetch it again when the version changes
+	GetSchema(ctx context.Context, in *SchemaRequest, opts ...grpc.CallOption) (*Schema, error)
 }
 
 type zeroClient struct {
@@ -72,6 +80,65 @@ func (c *zeroClient) GetLeader(ctx context.Context, in *Group, opts ...grpc.Call
 	return out, nil
 }
 
+func (c *zeroClient) WatchGroups(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Zero_WatchGroupsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Zero_ServiceDesc.Streams[0], "/zeroGrpc.Zero/WatchGroups", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &zeroWatchGroupsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Zero_WatchGroupsClient interface {
+	Recv() (*GroupEvent, error)
+	grpc.ClientStream
+}
+
+type zeroWatchGroupsClient struct {
+	grpc.ClientStream
+}
+
+func (x *zeroWatchGroupsClient) Recv() (*GroupEvent, error) {
+	m := new(GroupEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *zeroClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, "/zeroGrpc.Zero/Heartbeat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *zeroClient) RemoveNode(ctx context.Context, in *Node, opts ...grpc.CallOption) (*Group, error) {
+	out := new(Group)
+	err := c.cc.Invoke(ctx, "/zeroGrpc.Zero/RemoveNode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *zeroClient) GetSchema(ctx context.Context, in *SchemaRequest, opts ...grpc.CallOption) (*Schema, error) {
+	out := new(Schema)
+	err := c.cc.Invoke(ctx, "/zeroGrpc.Zero/GetSchema", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ZeroServer is the server API for Zero service.
 // All implementations must embed UnimplementedZeroServer
 // for forward compatibility
@@ -80,6 +147,14 @@ type ZeroServer interface {
 	CreateAGroup(context.Context, *Node) (*Group, error)
 	UpdateLeader(context.Context, *Node) (*Group, error)
 	GetLeader(context.Context, *Group) (*Node, error)
+	// streams every group once and then each change as it is applied
+	WatchGroups(*WatchRequest, Zero_WatchGroupsServer) error
+	// alphas report that they are alive every heartbeat interval
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	// removes the node from its group, including the raft configuration of the group
+	RemoveNode(context.Context, *Node) (*Group, error)
+	// the schema of the relations, alphas fetch it again when the version changes
+	GetSchema(context.Context, *SchemaRequest) (*Schema, error)
 	mustEmbedUnimplementedZeroServer()
 }
 
@@ -99,6 +174,18 @@ func (UnimplementedZeroServer) UpdateLeader(context.Context, *Node) (*Group, err
 func (UnimplementedZeroServer) GetLeader(context.Context, *Group) (*Node, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetLeader not implemented")
 }
+func (UnimplementedZeroServer) WatchGroups(*WatchRequest, Zero_WatchGroupsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchGroups not implemented")
+}
+func (UnimplementedZeroServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedZeroServer) RemoveNode(context.Context, *Node) (*Group, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveNode not implemented")
+}
+func (UnimplementedZeroServer) GetSchema(context.Context, *SchemaRequest) (*Schema, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSchema not implemented")
+}
 func (UnimplementedZeroServer) mustEmbedUnimplementedZeroServer() {}
 
 // UnsafeZeroServer may be embedded to opt out of forward compatibility for this service.
@@ -184,6 +271,81 @@ func _Zero_GetLeader_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Zero_WatchGroups_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ZeroServer).WatchGroups(m, &zeroWatchGroupsServer{stream})
+}
+
+type Zero_WatchGroupsServer interface {
+	Send(*GroupEvent) error
+	grpc.ServerStream
+}
+
+type zeroWatchGroupsServer struct {
+	grpc.ServerStream
+}
+
+func (x *zeroWatchGroupsServer) Send(m *GroupEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Zero_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZeroServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zeroGrpc.Zero/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZeroServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Zero_RemoveNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Node)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZeroServer).RemoveNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zeroGrpc.Zero/RemoveNode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZeroServer).RemoveNode(ctx, req.(*Node))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Zero_GetSchema_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SchemaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ZeroServer).GetSchema(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/zeroGrpc.Zero/GetSchema",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ZeroServer).GetSchema(ctx, req.(*SchemaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Zero_ServiceDesc is the grpc.ServiceDesc for Zero service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -207,7 +369,25 @@ var Zero_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetLeader",
 			Handler:    _Zero_GetLeader_Handler,
 		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _Zero_Heartbeat_Handler,
+		},
+		{
+			MethodName: "RemoveNode",
+			Handler:    _Zero_RemoveNode_Handler,
+		},
+		{
+			MethodName: "GetSchema",
+			Handler:    _Zero_GetSchema_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchGroups",
+			Handler:       _Zero_WatchGroups_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "server.proto",
 }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	pb "example.com/graphd/cmd/zero/grpc"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+const (
+	defaultSuspectTimeout = 5 * time.Second
+	defaultDeadTimeout    = 15 * time.Second
+	healthCheckInterval   = time.Second
+)
+
+// nodeStatus is what the last heartbeat of a node told us, it is only kept
+// in memory on the zero leader, followers forward the heartbeats. The leader
+// replicates the changes of health so the followers route around the dead
+// nodes too, they know nothing else of the node.
+type nodeStatus struct {
+	lastSeen     time.Time
+	raftState    string
+	appliedIndex uint64
+	diskUsage    int64
+	keyCount     int64
+	health       pb.Health
+}
+
+// resetHealth forgets what we knew, done when we become the leader so that
+// every node gets a full timeout to reach us, the caller holds z.mut
+func (z *ZeroServer) resetHealth() {
+	z.status = make(map[string]*nodeStatus)
+	z.since = time.Now()
+}
+
+// expectHeartbeat gives a node that just registered a full timeout to send
+// its first heartbeat, the caller holds z.mut
+func (z *ZeroServer) expectHeartbeat(id string) {
+	if _, ok := z.status[id]; !ok {
+		z.status[id] = &nodeStatus{lastSeen: time.Now()}
+	}
+}
+
+// followHealth takes the health of the nodes the leader sent, the caller
+// holds z.mut
+func (z *ZeroServer) followHealth(health map[string]pb.Health) {
+	for id, h := range health {
+		n, ok := z.nInfo[id]
+		if !ok {
+			continue
+		}
+		st, ok := z.status[id]
+		if !ok {
+			st = &nodeStatus{}
+			z.status[id] = st
+		}
+		if st.health != h {
+			st.health = h
+			z.publish(pb.GroupEvent_HEALTH_CHANGED, n.GetGroupId(), z.withHealth(n))
+		}
+	}
+}
+
+// shareHealth replicates the health of the nodes whose health changed. It
+// is read again here, one at a time, so the last change of a node is the
+// last one the followers apply.
+func (z *ZeroServer) shareHealth(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	z.shareMut.Lock()
+	defer z.shareMut.Unlock()
+	health := make(map[string]pb.Health, len(ids))
+	z.mut.Lock()
+	for _, id := range ids {
+		if _, ok := z.nInfo[id]; ok {
+			health[id] = z.nodeHealth(id)
+		}
+	}
+	z.mut.Unlock()
+	if err := z.propose(&command{OpType: setHealth, Health: health}); err != nil {
+		z.logger.Error("Could not replicate the health of the nodes", zap.Error(err))
+	}
+}
+
+// nodeHealth the caller holds z.mut
+func (z *ZeroServer) nodeHealth(id string) pb.Health {
+	if st, ok := z.status[id]; ok {
+		return st.health
+	}
+	return pb.Health_UNKNOWN
+}
+
+// withHealth returns a copy of the node carrying its health, the nodes in
+// nInfo are persisted and never carry it, the caller holds z.mut
+func (z *ZeroServer) withHealth(n *pb.Node) *pb.Node {
+	if n == nil {
+		return nil
+	}
+	c := proto.Clone(n).(*pb.Node)
+	c.Health = z.nodeHealth(n.GetId())
+	return c
+}
+
+// groupHealth is alive when every node is alive and dead when the
+// majority is lost, the nodes nobody heard about are given the benefit of the doubt
+func groupHealth(nodes []*pb.Node) pb.Health {
+	var alive, unknown int
+	for _, n := range nodes {
+		switch n.GetHealth() {
+		case pb.Health_ALIVE:
+			alive++
+		case pb.Health_UNKNOWN:
+			unknown++
+		}
+	}
+	switch {
+	case unknown == len(nodes):
+		return pb.Health_UNKNOWN
+	case alive == len(nodes):
+		return pb.Health_ALIVE
+	case alive+unknown > len(nodes)/2:
+		return pb.Health_SUSPECT
+	default:
+		return pb.Health_DEAD
+	}
+}
+
+func (z *ZeroServer) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	if !z.isLeader() {
+		cl, err := z.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return cl.Heartbeat(ctx, req)
+	}
+	id := req.GetNode().GetId()
+	z.mut.Lock()
+	known, ok := z.nInfo[id]
+	if !ok {
+		z.mut.Unlock()
+		return nil, status.Errorf(codes.NotFound, "node %s is not part of any group", id)
+	}
+	st, ok := z.status[id]
+	if !ok {
+		st = &nodeStatus{}
+		z.status[id] = st
+	}
+	st.lastSeen = time.Now()
+	st.raftState = req.GetRaftState()
+	st.appliedIndex = req.GetAppliedIndex()
+	st.diskUsage = req.GetDiskUsage()
+	st.keyCount = req.GetKeyCount()
+	var changed []string
+	if st.health != pb.Health_ALIVE {
+		st.health = pb.Health_ALIVE
+		z.publish(pb.GroupEvent_HEALTH_CHANGED, known.GetGroupId(), z.withHealth(known))
+		changed = []string{id}
+	}
+	// the node might have missed telling us it became the leader
+	stale := false
+	if entry, ok := z.gInfo[known.GetGroupId()]; ok {
+		stale = st.raftState == raft.Leader.String() && entry.leader.GetId() != id
+	}
+	version := z.schemaVersion
+	z.mut.Unlock()
+	z.shareHealth(changed)
+	if stale {
+		z.logger.Info("Heartbeat from an unknown leader", zap.String("node", id))
+		if err := z.propose(&command{OpType: updateLeader, Node: known}); err != nil {
+			z.logger.Error("Could not update the leader", zap.Error(err))
+		}
+	}
+	return &pb.HeartbeatResponse{SchemaVersion: version}, nil
+}
+
+// monitorHealth marks the nodes we have not heard from as suspect and then dead
+func (z *ZeroServer) monitorHealth() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if z.isLeader() {
+			z.checkHealth(now)
+		}
+	}
+}
+
+func (z *ZeroServer) checkHealth(now time.Time) {
+	var changed []string
+	defer func() { z.shareHealth(changed) }()
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	for id, n := range z.nInfo {
+		st, ok := z.status[id]
+		if !ok {
+			st = &nodeStatus{lastSeen: z.since}
+			z.status[id] = st
+		}
+		health := pb.Health_ALIVE
+		switch elapsed := now.Sub(st.lastSeen); {
+		case elapsed > z.deadTimeout:
+			health = pb.Health_DEAD
+		case elapsed > z.suspectTimeout:
+			health = pb.Health_SUSPECT
+		}
+		if health != st.health {
+			z.logger.Info("Node health changed", zap.String("node", id), zap.String("health", health.String()))
+			st.health = health
+			z.publish(pb.GroupEvent_HEALTH_CHANGED, n.GetGroupId(), z.withHealth(n))
+			changed = append(changed, id)
+		}
+	}
+}
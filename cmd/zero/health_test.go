@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"go.uber.org/zap"
+)
+
+func TestFollowHealth(t *testing.T) {
+	z, err := newZeroServer(zap.NewNop(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a1", "a2", "a3"} {
+		z.nInfo[id] = &pb.Node{Id: id, GroupId: "g1", HttpAddress: id + ":80"}
+	}
+	z.gInfo["g1"] = &groupInfo{leader: z.nInfo["a1"], members: 3}
+	events := make(chan *pb.GroupEvent, 10)
+	z.watchers[1] = events
+
+	z.mut.Lock()
+	z.followHealth(map[string]pb.Health{"a1": pb.Health_ALIVE, "a2": pb.Health_DEAD, "a3": pb.Health_ALIVE, "gone": pb.Health_DEAD})
+	z.followHealth(map[string]pb.Health{"a3": pb.Health_ALIVE})
+	z.mut.Unlock()
+	if len(events) != 3 {
+		t.Errorf("published %d changes of health, want 3", len(events))
+	}
+	if _, ok := z.status["gone"]; ok {
+		t.Error("the health of a node not in the cluster was kept")
+	}
+
+	s := &httpService{server: z}
+	got := s.targets("g1", false)
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "a1:80" || got[1] != "a3:80" {
+		t.Errorf("the follower routes to %v, want a1:80 and a3:80", got)
+	}
+	z.mut.Lock()
+	z.followHealth(map[string]pb.Health{"a1": pb.Health_DEAD})
+	grp := z.group("g1")
+	z.mut.Unlock()
+	if got := s.targets("g1", true); len(got) != 0 {
+		t.Errorf("the follower routes to the dead leader, %v", got)
+	}
+	if grp.GetHealth() != pb.Health_DEAD {
+		t.Errorf("the group without its majority is %s, want DEAD", grp.GetHealth())
+	}
+}
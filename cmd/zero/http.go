@@ -2,10 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	pb "example.com/graphd/cmd/zero/grpc"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"strings"
 )
 
 type httpService struct {
@@ -13,21 +16,115 @@ type httpService struct {
 	logger *zap.Logger
 	server *ZeroServer
 	c      *consistentHashHandler
+	client *http.Client
 }
 
 const (
 	SEPARATOR = "%"
+	// the alphas keep their own keys under ids starting with it, they are
+	// not moved with the data so clients can not write them
+	reservedPrefix = "!"
 )
 
+// handleKeyOps serves the alpha api, the request is passed on to the
+// group that owns the key so clients do not have to route themselves
 func (s *httpService) handleKeyOps(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	key := vars["id"]
 	relation := vars["relation"]
-	predicate := key + SEPARATOR + relation
-	mem := s.c.c.LocateKey([]byte(predicate))
-	grp, err := s.server.GetGroupInfo(mem.String())
+	if r.Method != http.MethodGet && strings.HasPrefix(vars["id"], reservedPrefix) {
+		s.writeError(w, 400, "The ids starting with "+reservedPrefix+" are reserved")
+		return
+	}
+	if r.Method != http.MethodGet && strings.HasPrefix(relation, reversePrefix) {
+		s.writeError(w, 400, "The reverse relations are maintained by the zero")
+		return
+	}
+	grp, err := s.server.groupFor(vars["id"], relation)
+	if err != nil {
+		s.writeError(w, 503, "There are no groups to serve the key")
+		return
+	}
+	if r.Method != http.MethodGet && s.server.isReverse(relation) {
+		s.reverseWrite(w, r, grp)
+		return
+	}
+	s.proxy(w, r, grp)
+}
+
+// handleNodeDelete removes every relation of a key, they are spread over
+// the ring so the request goes to every group
+func (s *httpService) handleNodeDelete(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(mux.Vars(r)["id"], reservedPrefix) {
+		s.writeError(w, 400, "The ids starting with "+reservedPrefix+" are reserved")
+		return
+	}
+	s.server.mut.Lock()
+	grps := make([]string, 0, len(s.server.gInfo))
+	for id := range s.server.gInfo {
+		grps = append(grps, id)
+	}
+	s.server.mut.Unlock()
+	// the edges between the node and the others through relations marked
+	// @reverse are read before they are gone
+	edges, err := s.reverseEdges(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		s.logger.Error("Could not read the reverse edges", zap.Error(err))
+		s.writeError(w, 502, "Could not read the reverse edges of the key")
+		return
+	}
+	var failed []string
+	indexes := make(map[string]uint64, len(grps))
+	for _, grp := range grps {
+		resp := s.send(r, nil, grp)
+		if resp == nil {
+			failed = append(failed, grp)
+			continue
+		}
+		var res struct {
+			Index uint64 `json:"index"`
+		}
+		err := json.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || err != nil {
+			failed = append(failed, grp)
+			continue
+		}
+		indexes[grp] = res.Index
+	}
+	if len(failed) > 0 {
+		s.logger.Error("Could not delete the key on every group", zap.Strings("groups", failed))
+		s.writeError(w, 502, "Could not delete the key on the groups "+strings.Join(failed, ", "))
+		return
+	}
+	for _, e := range edges {
+		if err := s.removeEdge(r.Context(), e); err != nil {
+			s.logger.Error("Could not remove the reverse edge", zap.Error(err))
+			failed = append(failed, e.id)
+		}
+	}
+	if len(failed) > 0 {
+		s.writeError(w, 502, "The key was deleted but not the edges of "+strings.Join(failed, ", "))
+		return
+	}
+	// the raft index of the delete on each group
+	s.writeJSON(w, map[string]interface{}{"indexes": indexes})
+}
+
+// handleLocate returns the group owning the key and its leader
+func (s *httpService) handleLocate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	mem, err := s.server.groupFor(vars["id"], vars["relation"])
+	if err != nil {
+		s.writeError(w, 503, "There are no groups to serve the key")
+		return
+	}
+	grp, err := s.server.GetGroupInfo(mem)
 	if err != nil {
-		http.Error(w, "Could not get the keyinfo", 500)
+		s.writeError(w, 500, "Could not get the keyinfo")
+		return
+	}
+	if grp.GetHealth() == pb.Health_DEAD {
+		s.writeError(w, 503, "The group owning the key has lost the majority")
 		return
 	}
 	type response struct {
@@ -44,12 +141,97 @@ func (s *httpService) handleKeyOps(w http.ResponseWriter, r *http.Request) {
 	}
 	bytes, err := json.Marshal(resp)
 	if err != nil {
-		http.Error(w, "Could marshal data", 500)
+		s.writeError(w, 500, "Could marshal data")
+		return
+	}
+	_, err = w.Write(bytes)
+	if err != nil {
+		s.writeError(w, 500, "Error in writing response")
+		return
+	}
+}
+
+// forwardToLeader passes a request that changes the cluster state on to the
+// zero leader, it returns false when we are the leader and should handle it
+func (s *httpService) forwardToLeader(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if s.server.isLeader() {
+		return false
+	}
+	leader, err := s.server.leaderPeer()
+	if err != nil {
+		s.writeError(w, 503, "Zero has no leader")
+		return true
+	}
+	resp, err := s.forward(r, body, leader.HttpAddress)
+	if err != nil {
+		s.writeError(w, 502, "Could not forward the request to the leader")
+		return true
+	}
+	defer resp.Body.Close()
+	s.copyResponse(w, resp)
+	return true
+}
+
+// errors are answered as {"code": "...", "error": "..."} like the alphas do
+// so that a client going through a zero sees the same errors
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusNotFound:            "not_found",
+	http.StatusMisdirectedRequest:  "not_leader",
+	http.StatusInternalServerError: "internal",
+	http.StatusBadGateway:          "bad_gateway",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusGatewayTimeout:      "timeout",
+}
+
+func (s *httpService) writeError(w http.ResponseWriter, status int, msg string) {
+	type apiError struct {
+		Code    string `json:"code"`
+		Message string `json:"error"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(&apiError{Code: errorCodes[status], Message: msg}); err != nil {
+		s.logger.Error("Error in writing response", zap.Error(err))
+	}
+}
+
+func (s *httpService) writeJSON(w http.ResponseWriter, v interface{}) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		s.writeError(w, 500, "Could marshal data")
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(bytes)
 	if err != nil {
-		http.Error(w, "Error in writing response", 500)
+		s.logger.Error("Error in writing response", zap.Error(err))
+	}
+}
+
+// handleJoin adds a zero to the raft group, followers pass the request on
+// to the leader since only it can change the raft configuration
+func (s *httpService) handleJoin(w http.ResponseWriter, r *http.Request) {
+	s.logger.Info("Got join message")
+	b, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		s.writeError(w, 400, "Could not open request body")
+		return
+	}
+	if s.forwardToLeader(w, r, b) {
+		return
+	}
+	var peer zeroPeer
+	err = json.Unmarshal(b, &peer)
+	if err != nil || peer.Id == "" || peer.RaftAddress == "" {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	err = s.server.joinPeer(&peer)
+	if err != nil {
+		s.logger.Error("The zero could not join", zap.Error(err))
+		s.writeError(w, 500, "The requesting zero could not join")
 		return
 	}
 }
@@ -57,7 +239,21 @@ func (s *httpService) handleKeyOps(w http.ResponseWriter, r *http.Request) {
 func (s *httpService) Start() {
 	s.logger.Info("Server Starting", zap.String("address", s.addr))
 	r := mux.NewRouter()
-	r.HandleFunc("/{id}/{relation}", s.handleKeyOps).Methods("GET", "PUT")
+	r.HandleFunc("/join", s.handleJoin).Methods("POST")
+	r.HandleFunc("/state", s.handleState).Methods("GET")
+	r.HandleFunc("/locate/{id}/{relation}", s.handleLocate).Methods("GET")
+	r.HandleFunc("/tablet/{relation}", s.handleTabletGet).Methods("GET")
+	r.HandleFunc("/tablet/{relation}", s.handleTabletPut).Methods("PUT")
+	r.HandleFunc("/schema", s.handleSchemaGet).Methods("GET")
+	r.HandleFunc("/schema/{relation}", s.handleSchemaGet).Methods("GET")
+	r.HandleFunc("/schema/{relation}", s.handleSchemaPut).Methods("PUT")
+	r.HandleFunc("/traverse", s.handleTraverse).Methods("POST")
+	r.HandleFunc("/shortest", s.handleShortest).Methods("POST")
+	r.HandleFunc("/query", s.handleQuery).Methods("POST")
+	r.HandleFunc("/search", s.handleSearch).Methods("POST")
+	r.HandleFunc("/{id}/{relation}", s.handleKeyOps).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/{id}/{relation}/{value}", s.handleKeyOps).Methods("DELETE")
+	r.HandleFunc("/{id}", s.handleNodeDelete).Methods("DELETE")
 	http.Handle("/", r)
 	srv := http.Server{
 		Handler: r,
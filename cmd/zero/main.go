@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	pb "example.com/graphd/cmd/zero/grpc"
 	"flag"
 	"fmt"
@@ -8,8 +10,28 @@ import (
 	"go.uber.org/zap"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 )
 
+// join asks the zero at joinAddr to add us to the zero raft group
+func join(joinAddr string, self *zeroPeer) error {
+	b, err := json.Marshal(self)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(fmt.Sprintf("http://%s/join", joinAddr), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("join refused with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
 func main() {
 	logger, err := zap.NewProduction()
 	if err != nil {
@@ -18,15 +40,27 @@ func main() {
 	defer logger.Sync()
 	logger.Info("Hello from zap logger")
 
+	id := flag.String("id", "master", "Id of the zero")
 	httpAddr := flag.String("haddr", "localhost:4447", "Set the address for the HTTP server")
-	grpcAddr := flag.String("gaddr", "localhost:4448", "Set the address for the Raft")
+	grpcAddr := flag.String("gaddr", "localhost:4448", "Set the address for the GRPC server")
+	raftAddr := flag.String("raddr", "localhost:4449", "Set the address for the Raft")
+	joinAddr := flag.String("join", "", "HTTP address of a zero to join, leave empty to bootstrap a new zero group")
+	suspect := flag.Duration("suspect", defaultSuspectTimeout, "Mark a node suspect when no heartbeat arrived for this long")
+	replicas := flag.Int("replicas", defaultReplicas, "Number of nodes in a group, a new group is started when every group has that many")
+	placement := flag.String("placement", placementWarn, "strict refuses a node when every group with room has a replica in its zone and rack, warn only logs it")
+	dead := flag.Duration("dead", defaultDeadTimeout, "Mark a node dead when no heartbeat arrived for this long")
 
 	flag.Parse()
 
+	path := filepath.Join("./build/data", *id)
+	if err := os.MkdirAll(path, 0700); err != nil {
+		logger.Fatal("Could not create the data directory", zap.Error(err))
+	}
+
 	// we can use this to check out if a node is down in each group.
 	// each group would coordinate using raft
 	// as long as the majority of nodes in each group are live we would have consistency
-	handle, err := bolt.Open("./build/data/master/shard.db", 0600, bolt.DefaultOptions)
+	handle, err := bolt.Open(filepath.Join(path, "shard.db"), 0600, bolt.DefaultOptions)
 	if err != nil {
 		fmt.Println(err)
 		logger.Fatal("Could not open connection to bolt storage")
@@ -34,21 +68,61 @@ func main() {
 	}
 	defer handle.Close()
 	ch, err := newConsistentHashHandler(handle)
+	if err != nil {
+		logger.Fatal("Could not create the buckets in bolt storage", zap.Error(err))
+	}
 
 	listener, err := net.Listen("tcp", *grpcAddr)
 	if err != nil {
 		log.Fatalf("Error in starting Zero GRPC Listener: %v\n", err)
 	}
-	zeroServer, err := newZeroServer(logger, ch)
+	self := &zeroPeer{
+		Id:          *id,
+		RaftAddress: *raftAddr,
+		GrpcAddress: *grpcAddr,
+		HttpAddress: *httpAddr,
+	}
+	zeroServer, err := newZeroServer(logger, ch, self)
+	zeroServer.suspectTimeout = *suspect
+	zeroServer.deadTimeout = *dead
+	zeroServer.replicas = *replicas
+	if *placement != placementStrict && *placement != placementWarn {
+		logger.Fatal("The placement should be strict or warn", zap.String("placement", *placement))
+	}
+	zeroServer.placement = *placement
+	if err := zeroServer.loadState(); err != nil {
+		logger.Fatal("Could not recover the cluster state from bolt storage", zap.Error(err))
+	}
+	cfg := raftConfig{
+		id:        *id,
+		path:      path,
+		addr:      *raftAddr,
+		bootstrap: *joinAddr == "",
+	}
+	zeroServer.raft, err = newRaft(&cfg, &zeroFSM{z: zeroServer, logger: logger})
+	if err != nil {
+		logger.Fatal("Could not start raft, try deleting the data directory", zap.Error(err))
+	}
+	go zeroServer.monitorLeadership()
+	go zeroServer.monitorHealth()
+	go zeroServer.rebalancer()
+
 	pb.RegisterZeroServer(zeroServer.Server, zeroServer)
 	httpSrv := &httpService{
 		addr:   *httpAddr,
 		logger: logger,
 		server: zeroServer,
 		c:      ch,
+		client: &http.Client{Timeout: proxyTimeout},
 	}
-	logger.Info(fmt.Sprintf("Running Zero at addr: %s, %s", *httpAddr, *grpcAddr))
+	logger.Info(fmt.Sprintf("Running Zero at addr: %s, %s, %s", *httpAddr, *grpcAddr, *raftAddr))
 	go httpSrv.Start()
+	go httpSrv.reverser()
+	if *joinAddr != "" {
+		if err := join(*joinAddr, self); err != nil {
+			logger.Fatal("Could not join the zero group", zap.Error(err))
+		}
+	}
 	err = zeroServer.Server.Serve(listener)
 	if err != nil {
 		logger.Fatal("Could not start zero GRPC server")
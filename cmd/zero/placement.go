@@ -0,0 +1,114 @@
+package main
+
+import (
+	pb "example.com/graphd/cmd/zero/grpc"
+	"sort"
+)
+
+// A joining node fills the existing groups up to the replication factor.
+// The replicas of a group are kept in distinct failure domains, the groups
+// where the node would share a zone and rack with a member come last, then
+// the groups holding the least data so the node catches up quickly, and
+// among those the one with the fewest replicas. When every group is full the
+// node starts a new group and takes over some partitions.
+
+const defaultReplicas = 3
+
+// what to do when the only groups with room already have a member in the
+// failure domain of the joining node
+const (
+	placementStrict = "strict" // refuse the node
+	placementWarn   = "warn"   // let it join and log it
+)
+
+// failureDomain is "" for the nodes that did not tell where they run
+func failureDomain(n *pb.Node) string {
+	if n.GetZone() == "" && n.GetRack() == "" {
+		return ""
+	}
+	return n.GetZone() + "/" + n.GetRack()
+}
+
+// groupLoad is the disk usage reported by the members of the group, the
+// caller holds z.mut
+func (z *ZeroServer) groupLoad(id string) int64 {
+	var load int64
+	for nid, n := range z.nInfo {
+		if n.GetGroupId() != id {
+			continue
+		}
+		if st, ok := z.status[nid]; ok {
+			load += st.diskUsage
+		}
+	}
+	return load
+}
+
+// sharedDomains counts the members of the group in the same failure domain
+// and in the same zone as the node, the caller holds z.mut
+func (z *ZeroServer) sharedDomains(id string, node *pb.Node) (domain, zone int) {
+	d := failureDomain(node)
+	for _, n := range z.nInfo {
+		if n.GetGroupId() != id || n.GetId() == node.GetId() {
+			continue
+		}
+		if d != "" && failureDomain(n) == d {
+			domain++
+		}
+		if node.GetZone() != "" && n.GetZone() == node.GetZone() {
+			zone++
+		}
+	}
+	return domain, zone
+}
+
+// pickGroup returns the group the node should join or "" when every group
+// is full or unreachable, conflict tells that the node would share its
+// failure domain with a member of the group, the caller holds z.mut
+func (z *ZeroServer) pickGroup(node *pb.Node) (grp string, conflict bool) {
+	type candidate struct {
+		id      string
+		domain  int
+		zone    int
+		members int
+		load    int64
+	}
+	var candidates []candidate
+	for id, entry := range z.gInfo {
+		if entry.members >= z.replicas {
+			continue
+		}
+		// we join through the leader, it has to be up
+		if entry.leader == nil || z.nodeHealth(entry.leader.GetId()) == pb.Health_DEAD {
+			continue
+		}
+		domain, zone := z.sharedDomains(id, node)
+		candidates = append(candidates, candidate{
+			id:      id,
+			domain:  domain,
+			zone:    zone,
+			members: entry.members,
+			load:    z.groupLoad(id),
+		})
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.domain != b.domain {
+			return a.domain < b.domain
+		}
+		if a.zone != b.zone {
+			return a.zone < b.zone
+		}
+		if a.load != b.load {
+			return a.load < b.load
+		}
+		if a.members != b.members {
+			return a.members < b.members
+		}
+		return a.id < b.id
+	})
+	return candidates[0].id, candidates[0].domain > 0
+}
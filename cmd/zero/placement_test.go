@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/raft"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPickGroup(t *testing.T) {
+	type group struct {
+		members int
+		usage   int64
+		dead    bool
+	}
+	tests := []struct {
+		name   string
+		groups map[string]group
+		want   string
+	}{
+		{"none", map[string]group{}, ""},
+		{"least data", map[string]group{"g1": {1, 500, false}, "g2": {2, 100, false}}, "g2"},
+		{"fewest members with the same data", map[string]group{"g1": {2, 100, false}, "g2": {1, 100, false}}, "g2"},
+		{"full ones skipped", map[string]group{"g1": {3, 0, false}, "g2": {2, 900, false}}, "g2"},
+		{"dead leader skipped", map[string]group{"g1": {1, 0, true}, "g2": {2, 900, false}}, "g2"},
+		{"all full", map[string]group{"g1": {3, 0, false}}, ""},
+		{"by id at last", map[string]group{"g2": {1, 0, false}, "g1": {1, 0, false}}, "g1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, err := newZeroServer(zap.NewNop(), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for id, g := range tt.groups {
+				for i := 0; i < g.members; i++ {
+					n := &pb.Node{Id: fmt.Sprint(id, "-", i), GroupId: id}
+					z.nInfo[n.Id] = n
+					z.status[n.Id] = &nodeStatus{diskUsage: g.usage / int64(g.members), health: pb.Health_ALIVE}
+					if i == 0 {
+						z.gInfo[id] = &groupInfo{leader: n, members: g.members}
+						if g.dead {
+							z.status[n.Id].health = pb.Health_DEAD
+						}
+					}
+				}
+			}
+			if got, _ := z.pickGroup(&pb.Node{Id: "new"}); got != tt.want {
+				t.Errorf("pickGroup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickGroupDomains(t *testing.T) {
+	// members of the groups as zone/rack
+	tests := []struct {
+		name     string
+		groups   map[string][]string
+		want     string
+		conflict bool
+	}{
+		{"another zone first", map[string][]string{"g1": {"z1/r2"}, "g2": {"z2/r1", "z3/r1"}}, "g2", false},
+		{"another rack before the same one", map[string][]string{"g1": {"z1/r1"}, "g2": {"z1/r2"}}, "g2", false},
+		{"fewest members in the zone", map[string][]string{"g1": {"z1/r2", "z1/r3"}, "g2": {"z1/r2", "z2/r1"}}, "g2", false},
+		{"shared domain last", map[string][]string{"g1": {"z1/r1"}, "g2": {"z1/r2", "z1/r3"}}, "g2", false},
+		{"only shared domains", map[string][]string{"g1": {"z1/r1", "z2/r1"}, "g2": {"z1/r1"}}, "g2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z, err := newZeroServer(zap.NewNop(), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for id, members := range tt.groups {
+				for i, d := range members {
+					zr := strings.SplitN(d, "/", 2)
+					n := &pb.Node{Id: fmt.Sprint(id, "-", i), GroupId: id, Zone: zr[0], Rack: zr[1]}
+					z.nInfo[n.Id] = n
+					z.status[n.Id] = &nodeStatus{health: pb.Health_ALIVE}
+					if i == 0 {
+						z.gInfo[id] = &groupInfo{leader: n, members: len(members)}
+					}
+				}
+			}
+			got, conflict := z.pickGroup(&pb.Node{Id: "new", Zone: "z1", Rack: "r1"})
+			if got != tt.want || conflict != tt.conflict {
+				t.Errorf("pickGroup() = %q, %v, want %q, %v", got, conflict, tt.want, tt.conflict)
+			}
+		})
+	}
+}
+
+func TestSharedDomains(t *testing.T) {
+	z, err := newZeroServer(zap.NewNop(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*pb.Node{
+		{Id: "a1", GroupId: "g1", Zone: "z1", Rack: "r1"},
+		{Id: "a2", GroupId: "g1", Zone: "z1", Rack: "r2"},
+		{Id: "a3", GroupId: "g1"},
+		{Id: "a4", GroupId: "g2", Zone: "z1", Rack: "r1"},
+	} {
+		z.nInfo[n.Id] = n
+	}
+	tests := []struct {
+		node         *pb.Node
+		domain, zone int
+	}{
+		{&pb.Node{Id: "new", Zone: "z1", Rack: "r1"}, 1, 2},
+		{&pb.Node{Id: "new", Zone: "z1", Rack: "r3"}, 0, 2},
+		{&pb.Node{Id: "new", Zone: "z2", Rack: "r1"}, 0, 0},
+		// the nodes without a zone and rack share nothing
+		{&pb.Node{Id: "new"}, 0, 0},
+		// nor does a member with itself
+		{&pb.Node{Id: "a1", Zone: "z1", Rack: "r1"}, 0, 1},
+	}
+	for _, tt := range tests {
+		domain, zone := z.sharedDomains("g1", tt.node)
+		if domain != tt.domain || zone != tt.zone {
+			t.Errorf("sharedDomains(%s %s/%s) = %d, %d, want %d, %d", tt.node.Id, tt.node.Zone, tt.node.Rack,
+				domain, zone, tt.domain, tt.zone)
+		}
+	}
+}
+
+// newTestZero starts a single zero as the raft leader over an in memory
+// transport, with the ring in a bolt file of the test
+func newTestZero(t *testing.T) *ZeroServer {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "shard.db"), 0600, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	ch, err := newConsistentHashHandler(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := newZeroServer(zap.NewNop(), ch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := raft.DefaultConfig()
+	cfg.LocalID = "z1"
+	cfg.HeartbeatTimeout = 50 * time.Millisecond
+	cfg.ElectionTimeout = 50 * time.Millisecond
+	cfg.LeaderLeaseTimeout = 50 * time.Millisecond
+	cfg.CommitTimeout = 5 * time.Millisecond
+	cfg.LogOutput = io.Discard
+	addr, transport := raft.NewInmemTransport("z1")
+	store := raft.NewInmemStore()
+	z.raft, err = raft.NewRaft(cfg, &zeroFSM{z: z, logger: zap.NewNop()}, store, store, raft.NewInmemSnapshotStore(), transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { z.raft.Shutdown().Error() })
+	err = z.raft.BootstrapCluster(raft.Configuration{Servers: []raft.Server{{ID: "z1", Address: addr}}}).Error()
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-z.raft.LeaderCh():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the zero did not become the leader")
+	}
+	return z
+}
+
+func TestJoinPlacement(t *testing.T) {
+	for _, placement := range []string{placementWarn, placementStrict} {
+		t.Run(placement, func(t *testing.T) {
+			z := newTestZero(t)
+			z.placement = placement
+			ctx := context.Background()
+			if _, err := z.JoinAGroup(ctx, &pb.Node{Id: "a1", Zone: "z1", Rack: "r1"}); err != nil {
+				t.Fatal(err)
+			}
+			grp, err := z.JoinAGroup(ctx, &pb.Node{Id: "a2", Zone: "z1", Rack: "r1"})
+			if placement == placementStrict {
+				if status.Code(err) != codes.FailedPrecondition {
+					t.Fatalf("the strict placement let the node in the same rack join, %v", err)
+				}
+				if _, ok := z.nInfo["a2"]; ok {
+					t.Error("the refused node was added")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if grp.GetMembers() != 2 {
+				t.Errorf("the group has %d members, want 2", grp.GetMembers())
+			}
+		})
+	}
+}
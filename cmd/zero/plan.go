@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	pb "example.com/graphd/cmd/zero/grpc"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// A query runs a level of blocks at a time. The keys a level needs, every
+// node with every relation of its fields, are split by the group owning them
+// and each group gets a single batch read, all the groups in parallel. The
+// filters are planned the same way, the relations they test are read for all
+// the candidate nodes at once. The facets come with the values so the facet
+// filters and orderings need no read of their own. A search function runs
+// once per query, its nodes are kept with the filter. Nested blocks then run
+// on the values kept.
+
+const (
+	// a query stops once it resolved this many nodes
+	maxQueryNodes = 100000
+	// the batches of a query sent at the same time
+	queryParallel = 16
+	// the size of a query request
+	maxQueryBytes = 1 << 20
+)
+
+// queryKey is id%relation
+type queryKey struct {
+	Id       string `json:"id"`
+	Relation string `json:"relation"`
+}
+
+type queryRequest struct {
+	Query       string `json:"query"`
+	Consistency string `json:"consistency"`
+}
+
+var errQueryTooLarge = fmt.Errorf("the query reached more than %d nodes", maxQueryNodes)
+
+// batch reads keys that all belong to the group in a single request
+func (s *httpService) batch(ctx context.Context, grp string, keys []queryKey, consistency string) ([][]edgeValue, error) {
+	b, err := json.Marshal(map[string][]queryKey{"keys": keys})
+	if err != nil {
+		return nil, err
+	}
+	uri := batchPath
+	if consistency != "" {
+		uri += "?" + url.Values{"consistency": {consistency}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp := s.send(req, b, grp)
+	if resp == nil {
+		return nil, fmt.Errorf("could not reach group %s", grp)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("group %s answered %d to a batch read", grp, resp.StatusCode)
+	}
+	var res struct {
+		Values [][]edgeValue `json:"values"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if len(res.Values) != len(keys) {
+		return nil, fmt.Errorf("group %s answered %d values for %d keys", grp, len(res.Values), len(keys))
+	}
+	return res.Values, nil
+}
+
+// readKeys reads the keys from the groups owning them, a missing key has no
+// values
+func (s *httpService) readKeys(ctx context.Context, keys []queryKey, consistency string) (map[queryKey][]edgeValue, error) {
+	type batchPlan struct {
+		grp  string
+		keys []queryKey
+	}
+	byGroup := make(map[string][]queryKey)
+	seen := make(map[queryKey]bool, len(keys))
+	for _, k := range keys {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		grp, err := s.server.groupFor(k.Id, k.Relation)
+		if err != nil {
+			return nil, err
+		}
+		byGroup[grp] = append(byGroup[grp], k)
+	}
+	var plans []batchPlan
+	for grp, ks := range byGroup {
+		for len(ks) > pb.MaxBatchKeys {
+			plans = append(plans, batchPlan{grp, ks[:pb.MaxBatchKeys]})
+			ks = ks[pb.MaxBatchKeys:]
+		}
+		plans = append(plans, batchPlan{grp, ks})
+	}
+	out := make(map[queryKey][]edgeValue, len(seen))
+	var mut sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, queryParallel)
+	var wg sync.WaitGroup
+	for _, pl := range plans {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(pl batchPlan) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			values, err := s.batch(ctx, pl.grp, pl.keys, consistency)
+			mut.Lock()
+			defer mut.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for i, k := range pl.keys {
+				out[k] = values[i]
+			}
+		}(pl)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// relations returns the relations whose values the filter tests
+func (e *filterExpr) relations() []string {
+	var out []string
+	if e.Op == "has" || e.Op == "eq" {
+		out = append(out, e.Relation)
+	}
+	for _, a := range e.Args {
+		out = append(out, a.relations()...)
+	}
+	return out
+}
+
+// searches returns the search functions of the filter
+func (e *filterExpr) searches() []*filterExpr {
+	if _, ok := pb.SearchFuncs[e.Op]; ok && e.Op != "eq" {
+		return []*filterExpr{e}
+	}
+	var out []*filterExpr
+	for _, a := range e.Args {
+		out = append(out, a.searches()...)
+	}
+	return out
+}
+
+// eval tells if the node passes the filter, vals holds the relations it tests
+func (e *filterExpr) eval(id string, vals map[queryKey][]edgeValue) bool {
+	switch e.Op {
+	case "and":
+		return e.Args[0].eval(id, vals) && e.Args[1].eval(id, vals)
+	case "or":
+		return e.Args[0].eval(id, vals) || e.Args[1].eval(id, vals)
+	case "not":
+		return !e.Args[0].eval(id, vals)
+	case "has":
+		return len(vals[queryKey{id, e.Relation}]) > 0
+	case "eq":
+		return contains(valueStrings(vals[queryKey{id, e.Relation}]), e.Values[0])
+	case "id":
+		return contains(e.Values, id)
+	case "anyofterms", "allofterms", "anyoftext", "alloftext":
+		return e.Found[id]
+	}
+	return false
+}
+
+func contains(vals []string, v string) bool {
+	for _, x := range vals {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// page returns the bounds of the page of n values that skips offset values
+// and keeps the first ones, all of them when first is 0
+func page(n, offset, first int) (int, int) {
+	if offset >= n {
+		return n, n
+	}
+	if first > 0 && offset+first < n {
+		return offset, offset + first
+	}
+	return offset, n
+}
+
+// edges returns the edges of a field that pass its facet filter, ordered by
+// its facet. The list is a copy, the values read are shared by the fields.
+func (f *queryBlock) edges(vals []edgeValue) []edgeValue {
+	out := make([]edgeValue, 0, len(vals))
+	for _, v := range vals {
+		if f.FacetFilter == nil || f.FacetFilter.evalFacets(v.Facets) {
+			out = append(out, v)
+		}
+	}
+	if f.OrderBy != "" {
+		sort.SliceStable(out, func(i, j int) bool {
+			return lessFacet(out[i], out[j], f.OrderBy, f.OrderDesc)
+		})
+	}
+	return out
+}
+
+// queryExec runs one query
+type queryExec struct {
+	s           *httpService
+	ctx         context.Context
+	consistency string
+	nodes       int
+}
+
+// search runs a search function, the nodes found are the same for every
+// level of the query so it runs once
+func (e *queryExec) search(f *filterExpr) ([]string, error) {
+	ids, err := e.s.search(e.ctx, &searchRequest{
+		Relation:    f.Relation,
+		Func:        f.Op,
+		Text:        f.Values[0],
+		Consistency: e.consistency,
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.Found = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		f.Found[id] = true
+	}
+	return ids, nil
+}
+
+// filter returns the nodes that pass the filter, in order and once each
+func (e *queryExec) filter(ids []string, f *filterExpr) ([]string, error) {
+	for _, sf := range f.searches() {
+		if sf.Found != nil {
+			continue
+		}
+		if _, err := e.search(sf); err != nil {
+			return nil, err
+		}
+	}
+	var keys []queryKey
+	for _, relation := range f.relations() {
+		for _, id := range ids {
+			keys = append(keys, queryKey{id, relation})
+		}
+	}
+	vals, err := e.s.readKeys(e.ctx, keys, e.consistency)
+	if err != nil {
+		return nil, err
+	}
+	var kept []string
+	for _, id := range ids {
+		if f.eval(id, vals) {
+			kept = append(kept, id)
+		}
+	}
+	return kept, nil
+}
+
+// resolve answers the fields for each node
+func (e *queryExec) resolve(ids []string, fields []*queryBlock) ([]map[string]interface{}, error) {
+	if e.nodes += len(ids); e.nodes > maxQueryNodes {
+		return nil, errQueryTooLarge
+	}
+	objs := make([]map[string]interface{}, len(ids))
+	for i, id := range ids {
+		objs[i] = map[string]interface{}{"id": id}
+	}
+	var keys []queryKey
+	for _, f := range fields {
+		for _, id := range ids {
+			keys = append(keys, queryKey{id, f.Name})
+		}
+	}
+	vals, err := e.s.readKeys(e.ctx, keys, e.consistency)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		per := make([][]edgeValue, len(ids))
+		var all []string
+		for i, id := range ids {
+			per[i] = f.edges(vals[queryKey{id, f.Name}])
+			all = append(all, valueStrings(per[i])...)
+		}
+		if f.Filter != nil {
+			kept, err := e.filter(dedupe(all), f.Filter)
+			if err != nil {
+				return nil, err
+			}
+			keep := make(map[string]bool, len(kept))
+			for _, v := range kept {
+				keep[v] = true
+			}
+			for i := range per {
+				var vs []edgeValue
+				for _, v := range per[i] {
+					if keep[v.Value] {
+						vs = append(vs, v)
+					}
+				}
+				per[i] = vs
+			}
+		}
+		all = nil
+		for i := range per {
+			lo, hi := page(len(per[i]), f.Offset, f.First)
+			per[i] = per[i][lo:hi]
+			all = append(all, valueStrings(per[i])...)
+		}
+		if f.Fields == nil {
+			for i := range per {
+				switch {
+				case len(per[i]) == 0:
+				case f.Facets:
+					objs[i][f.key()] = per[i]
+				default:
+					objs[i][f.key()] = valueStrings(per[i])
+				}
+			}
+			continue
+		}
+		children := dedupe(all)
+		childObjs, err := e.resolve(children, f.Fields)
+		if err != nil {
+			return nil, err
+		}
+		byId := make(map[string]map[string]interface{}, len(children))
+		for i, c := range children {
+			byId[c] = childObjs[i]
+		}
+		for i := range per {
+			if len(per[i]) == 0 {
+				continue
+			}
+			list := make([]map[string]interface{}, len(per[i]))
+			for j, v := range per[i] {
+				list[j] = byId[v.Value]
+				if f.Facets && len(v.Facets) > 0 {
+					// the node is shared, the facets belong to this edge
+					obj := make(map[string]interface{}, len(list[j])+1)
+					for k, x := range list[j] {
+						obj[k] = x
+					}
+					obj["@facets"] = v.Facets
+					list[j] = obj
+				}
+			}
+			objs[i][f.key()] = list
+		}
+	}
+	return objs, nil
+}
+
+// dedupe keeps the first occurrence of every value
+func dedupe(vals []string) []string {
+	seen := make(map[string]bool, len(vals))
+	out := make([]string, 0, len(vals))
+	for _, v := range vals {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (e *queryExec) run(blocks []*queryBlock) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(blocks))
+	for _, b := range blocks {
+		ids := dedupe(b.Ids)
+		if b.Func != nil {
+			var err error
+			if ids, err = e.search(b.Func); err != nil {
+				return nil, err
+			}
+		}
+		if b.Filter != nil {
+			var err error
+			if ids, err = e.filter(ids, b.Filter); err != nil {
+				return nil, err
+			}
+		}
+		lo, hi := page(len(ids), b.Offset, b.First)
+		objs, err := e.resolve(ids[lo:hi], b.Fields)
+		if err != nil {
+			return nil, err
+		}
+		out[b.key()] = objs
+	}
+	return out, nil
+}
+
+// handleQuery runs {"query": "..."} and answers the blocks by their names
+func (s *httpService) handleQuery(w http.ResponseWriter, r *http.Request) {
+	var req queryRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxQueryBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if !consistencies[req.Consistency] {
+		s.writeError(w, 400, "The consistency should be linearizable, leader or stale")
+		return
+	}
+	blocks, err := parseQuery(req.Query)
+	if err != nil {
+		s.writeError(w, 400, "Could not parse the query: "+err.Error())
+		return
+	}
+	e := &queryExec{s: s, ctx: r.Context(), consistency: req.Consistency}
+	res, err := e.run(blocks)
+	_, notIndexed := err.(*errNotIndexed)
+	switch {
+	case err == errQueryTooLarge:
+		s.writeError(w, 400, fmt.Sprintf("The query reached more than %d nodes", maxQueryNodes))
+	case notIndexed:
+		s.writeError(w, 400, "Could not run the query: "+err.Error())
+	case err != nil:
+		s.logger.Info("Could not run the query", zap.Error(err))
+		s.writeError(w, 502, "Could not read the keys of the query: "+err.Error())
+	default:
+		s.writeJSON(w, res)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPage(t *testing.T) {
+	tests := []struct {
+		n, offset, first int
+		lo, hi           int
+	}{
+		{5, 0, 0, 0, 5},
+		{5, 0, 2, 0, 2},
+		{5, 2, 2, 2, 4},
+		{5, 3, 2, 3, 5},
+		{5, 4, 10, 4, 5},
+		{5, 5, 1, 5, 5},
+		{5, 9, 0, 5, 5},
+		{0, 0, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		lo, hi := page(tt.n, tt.offset, tt.first)
+		if lo != tt.lo || hi != tt.hi {
+			t.Errorf("page(%d, %d, %d) = %d, %d, want %d, %d", tt.n, tt.offset, tt.first, lo, hi, tt.lo, tt.hi)
+		}
+	}
+}
+
+func TestFilterEval(t *testing.T) {
+	vals := map[queryKey][]edgeValue{
+		{"alice", "a"}: {{Value: "x"}},
+		{"alice", "c"}: {{Value: "paris"}},
+		{"bob", "b"}:   {{Value: "y"}},
+	}
+	tests := []struct {
+		filter string
+		id     string
+		want   bool
+	}{
+		{`has(a) or has(b) and has(c)`, "alice", true},
+		{`has(a) or has(b) and has(c)`, "bob", false},
+		{`(has(a) or has(b)) and has(c)`, "bob", false},
+		{`has(b) or has(a) and has(c)`, "bob", true},
+		{`not has(a) and has(b)`, "bob", true},
+		{`not (has(a) and has(b))`, "alice", true},
+		{`not has(a) or has(c)`, "alice", true},
+		{`not not has(a)`, "alice", true},
+		{`eq(c, "paris") and not id("bob")`, "alice", true},
+		{`eq(c, "paris") or id("bob")`, "bob", true},
+		{`eq(c, "rome")`, "alice", false},
+	}
+	for _, tt := range tests {
+		blocks, err := parseQuery(`{ q(id: "a") @filter(` + tt.filter + `) { name } }`)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.filter, err)
+		}
+		if got := blocks[0].Filter.eval(tt.id, vals); got != tt.want {
+			t.Errorf("%s on %s = %v, want %v", tt.filter, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestResolvePagesAfterFilter(t *testing.T) {
+	s := newTestService(t, map[string][]edgeValue{
+		"alice%friend":  {{Value: "bob"}, {Value: "carol"}, {Value: "dave"}, {Value: "erin"}, {Value: "frank"}},
+		"carol%city":    {{Value: "paris"}},
+		"erin%city":     {{Value: "paris"}},
+		"frank%city":    {{Value: "paris"}},
+		"bob%city":      {{Value: "rome"}},
+		"alice%city":    {{Value: "paris"}},
+		"carol%name":    {{Value: "Carol"}},
+		"erin%name":     {{Value: "Erin"}},
+		"frank%name":    {{Value: "Frank"}},
+		"dave%name":     {{Value: "Dave"}},
+		"nobody%friend": nil,
+	})
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			"field",
+			`{ q(id: "alice") { friend(first: 2) @filter(eq(city, "paris")) } }`,
+			`{"q":[{"friend":["carol","erin"],"id":"alice"}]}`,
+		},
+		{
+			"offset",
+			`{ q(id: "alice") { friend(offset: 1, first: 5) @filter(eq(city, "paris")) } }`,
+			`{"q":[{"friend":["erin","frank"],"id":"alice"}]}`,
+		},
+		{
+			"nested",
+			`{ q(id: "alice") { friend(offset: 2) @filter(eq(city, "paris")) { name } } }`,
+			`{"q":[{"friend":[{"id":"frank","name":["Frank"]}],"id":"alice"}]}`,
+		},
+		{
+			"root",
+			`{ q(id: ["bob", "carol", "dave", "erin"], first: 1, offset: 1) @filter(eq(city, "paris")) { name } }`,
+			`{"q":[{"id":"erin","name":["Erin"]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := parseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := &queryExec{s: s, ctx: context.Background()}
+			res, err := e.run(blocks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			json.Unmarshal(b, &got)
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %s, want %s", b, tt.want)
+			}
+		})
+	}
+}
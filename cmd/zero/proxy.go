@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	pb "example.com/graphd/cmd/zero/grpc"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	proxyAttempts = 3
+	proxyBackoff  = 200 * time.Millisecond
+	proxyTimeout  = 10 * time.Second
+)
+
+// retryable tells if another node of the group might serve the request,
+// the leader could have changed or the node could be down. A write is only
+// sent again when the node refused it, 421, since after any other failure
+// its raft entry may have been committed and applying it twice is not the
+// same as applying it once.
+func retryable(status int, read bool) bool {
+	return status == http.StatusMisdirectedRequest || (read && status >= 500)
+}
+
+// notSent tells if the request failed before reaching the node, the
+// connection could not be opened
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// forward sends the request to the alpha at addr and returns the response
+func (s *httpService) forward(r *http.Request, body []byte, addr string) (*http.Response, error) {
+	url := fmt.Sprintf("http://%s%s", addr, r.URL.RequestURI())
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	return s.client.Do(req)
+}
+
+// staleRead is the only read consistency of the alphas that replicas serve,
+// the others, and the default, need the leader
+const staleRead = "stale"
+
+const (
+	// batchPath reads many keys of a group at once
+	batchPath = "/batch"
+	// searchPath looks up the indexes of a group
+	searchPath = "/search"
+)
+
+// isRead tells if the request only reads keys
+func isRead(r *http.Request) bool {
+	return r.Method == http.MethodGet ||
+		(r.Method == http.MethodPost && (r.URL.Path == batchPath || r.URL.Path == searchPath))
+}
+
+// targets returns the alphas to try for a request to the group, writes and
+// the reads that need the leader only go to it while stale reads go to a
+// random replica first and the leader last. Dead nodes are skipped.
+func (s *httpService) targets(grp string, leaderOnly bool) []string {
+	leader, members := s.server.groupNodes(grp)
+	var addrs []string
+	if !leaderOnly {
+		rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+		for _, m := range members {
+			if m.GetId() != leader.GetId() && m.GetHealth() != pb.Health_DEAD {
+				addrs = append(addrs, m.GetHttpAddress())
+			}
+		}
+	}
+	if leader.GetHttpAddress() != "" && leader.GetHealth() != pb.Health_DEAD {
+		addrs = append(addrs, leader.GetHttpAddress())
+	}
+	return addrs
+}
+
+// proxy forwards a request for a key to the group that owns it
+func (s *httpService) proxy(w http.ResponseWriter, r *http.Request, grp string) {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		s.writeError(w, 400, "Could not open request body")
+		return
+	}
+	resp := s.send(r, body, grp)
+	if resp == nil {
+		s.writeError(w, 502, "Could not reach the group owning the key")
+		return
+	}
+	defer resp.Body.Close()
+	s.copyResponse(w, resp)
+}
+
+// copyResponse answers with the response of an alpha or of another zero
+func (s *httpService) copyResponse(w http.ResponseWriter, resp *http.Response) {
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		s.logger.Error("Error in writing response", zap.Error(err))
+	}
+}
+
+// send passes the request on to a node of the group and returns its answer
+// or nil when no node could serve it, if the node fails we look the group
+// up again since the leader might have changed. Writes are only retried
+// when they did not reach the node or it refused them, the other failures
+// are answered as they are.
+func (s *httpService) send(r *http.Request, body []byte, grp string) *http.Response {
+	read := isRead(r)
+	leaderOnly := !read || r.URL.Query().Get("consistency") != staleRead
+	for attempt := 0; attempt < proxyAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(proxyBackoff * time.Duration(attempt))
+		}
+		for _, addr := range s.targets(grp, leaderOnly) {
+			resp, err := s.forward(r, body, addr)
+			if err != nil {
+				s.logger.Info("Could not reach alpha", zap.String("addr", addr), zap.Error(err))
+				if !read && !notSent(err) {
+					// the write may have been applied
+					return nil
+				}
+				continue
+			}
+			if !retryable(resp.StatusCode, read) {
+				return resp
+			}
+			resp.Body.Close()
+		}
+	}
+	return nil
+}
+
+// groupNodes returns the leader and all the known members of a group
+func (z *ZeroServer) groupNodes(id string) (*pb.Node, []*pb.Node) {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	var leader *pb.Node
+	if entry, ok := z.gInfo[id]; ok {
+		leader = z.withHealth(entry.leader)
+	}
+	return leader, z.group(id).GetNodes()
+}
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+)
+
+// The query language is a small subset of DQL. A query holds blocks, each
+// starts from some nodes and names the relations to read, nested blocks
+// follow the values of a relation as nodes.
+//
+//	{
+//	  people(id: ["alice", "bob"], first: 10) @filter(has(friend)) {
+//	    lives-in
+//	    pals: friend(first: 5) @filter(eq(lives-in, "paris") and not id("carol")) {
+//	      lives-in
+//	    }
+//	  }
+//	}
+//
+// first and offset paginate the nodes of a root block and the values of a
+// relation. A filter keeps the nodes for which it holds, it combines
+// eq(relation, "value"), has(relation) and id("a", "b") with and, or, not
+// and parentheses. A name followed by ":" is the alias the result is
+// answered under. # starts a comment.
+//
+// A root block can start from the nodes a search finds instead of ids,
+// people(func: anyofterms(name, "alice bob")), with one of the functions of
+// search.go. Filters take anyofterms, allofterms, anyoftext and alloftext.
+//
+// @facets answers the facets of the edges of a relation. With a condition,
+// such as @facets(ge(weight, 2) and has(since)), it keeps the edges whose
+// facets pass it, eq, lt, le, gt, ge and has test a facet. With
+// @facets(orderasc: since) or orderdesc the values are ordered by a facet
+// before they are paginated. A field can have several @facets.
+//
+//	block     = [alias ":"] name "(" ("id" ":" ids | "func" ":" search) {"," page} ")" [filter] selection
+//	ids       = string | "[" string {"," string} "]"
+//	search    = name "(" name "," string ")"
+//	page      = ("first" | "offset") ":" number
+//	selection = "{" {field} "}"
+//	field     = [alias ":"] name ["(" page {"," page} ")"] {filter | facets} [selection]
+//	filter    = "@filter" "(" expr ")"
+//	facets    = "@facets" ["(" (expr | ("orderasc" | "orderdesc") ":" name) ")"]
+//	expr      = term {"or" term}
+//	term      = factor {"and" factor}
+//	factor    = "not" factor | "(" expr ")" | function
+
+// maxQueryDepth bounds the nesting of the blocks and of the filters
+const maxQueryDepth = 10
+
+// queryBlock is a root block or a field, the root blocks start from ids
+type queryBlock struct {
+	Alias string
+	Name  string
+	Ids   []string
+	// the search the root block starts from instead of ids
+	Func   *filterExpr
+	First  int
+	Offset int
+	Filter *filterExpr
+	// nil when the field has no selection and answers its values as they are
+	Fields []*queryBlock
+	// the facets of the edges are answered
+	Facets      bool
+	FacetFilter *filterExpr
+	OrderBy     string
+	OrderDesc   bool
+}
+
+// key is the name the result is answered under
+func (b *queryBlock) key() string {
+	if b.Alias != "" {
+		return b.Alias
+	}
+	return b.Name
+}
+
+// filterExpr is a node of a filter, and, or and not combine Args while eq,
+// has, id and the search functions test a node. In a facet filter Relation
+// is the facet and Literal what it is compared to.
+type filterExpr struct {
+	Op       string
+	Args     []*filterExpr
+	Relation string
+	Values   []string
+	Literal  interface{}
+	// the nodes a search function found, set by the planner
+	Found map[string]bool
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind      tokenKind
+	text      string
+	line, col int
+}
+
+// queryError tells where the query is malformed
+type queryError struct {
+	line, col int
+	msg       string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("line %d column %d: %s", e.line, e.col, e.msg)
+}
+
+// nameRune tells if r can be part of a name, relations such as lives-in
+// and ~friend are names and so are the numbers
+func nameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-~.", r)
+}
+
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	runes := []rune(src)
+	line, col := 1, 1
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := token{line: line, col: col}
+		switch {
+		case r == '\n':
+			i, line, col = i+1, line+1, 1
+			continue
+		case unicode.IsSpace(r):
+			i, col = i+1, col+1
+			continue
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.ContainsRune("{}()[]:,@", r):
+			start.kind, start.text = tokPunct, string(r)
+			i, col = i+1, col+1
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' && runes[j] != '\n' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) || runes[j] != '"' {
+				return nil, &queryError{line, col, "the string is not closed"}
+			}
+			s, err := strconv.Unquote(string(runes[i : j+1]))
+			if err != nil {
+				return nil, &queryError{line, col, "the string is malformed"}
+			}
+			start.kind, start.text = tokString, s
+			col += j + 1 - i
+			i = j + 1
+		case nameRune(r):
+			j := i
+			for j < len(runes) && nameRune(runes[j]) {
+				j++
+			}
+			start.kind, start.text = tokName, string(runes[i:j])
+			col += j - i
+			i = j
+		default:
+			return nil, &queryError{line, col, fmt.Sprintf("unexpected %q", r)}
+		}
+		toks = append(toks, start)
+	}
+	return append(toks, token{kind: tokEOF, line: line, col: col}), nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	// how deep the filter being read is nested
+	depth int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is tells if the next token is the punctuation or keyword text
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokPunct || t.kind == tokName) && t.text == text
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &queryError{t.line, t.col, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.errorf(p.peek(), "expected %q", text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) name() (string, error) {
+	t := p.next()
+	if t.kind != tokName {
+		return "", p.errorf(t, "expected a name")
+	}
+	return t.text, nil
+}
+
+func (p *parser) str() (string, error) {
+	t := p.next()
+	if t.kind != tokString {
+		return "", p.errorf(t, "expected a string")
+	}
+	return t.text, nil
+}
+
+// parseQuery returns the root blocks of the query
+func parseQuery(src string) ([]*queryBlock, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var blocks []*queryBlock
+	keys := make(map[string]bool)
+	for !p.is("}") {
+		t := p.peek()
+		if t.kind == tokEOF {
+			return nil, p.errorf(t, "expected \"}\" at the end of the query")
+		}
+		b, err := p.root()
+		if err != nil {
+			return nil, err
+		}
+		if keys[b.key()] {
+			return nil, p.errorf(t, "the block %q appears twice", b.key())
+		}
+		keys[b.key()] = true
+		blocks = append(blocks, b)
+	}
+	p.next()
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q after the query", t.text)
+	}
+	if len(blocks) == 0 {
+		return nil, p.errorf(toks[0], "the query has no blocks")
+	}
+	return blocks, nil
+}
+
+// aliasName reads "name" or "alias: name"
+func (p *parser) aliasName() (string, string, error) {
+	name, err := p.name()
+	if err != nil {
+		return "", "", err
+	}
+	if !p.is(":") {
+		return "", name, nil
+	}
+	p.next()
+	alias := name
+	if name, err = p.name(); err != nil {
+		return "", "", err
+	}
+	return alias, name, nil
+}
+
+func (p *parser) root() (*queryBlock, error) {
+	b := &queryBlock{}
+	var err error
+	if b.Alias, b.Name, err = p.aliasName(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case p.is("id"):
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if b.Ids, err = p.ids(); err != nil {
+			return nil, err
+		}
+	case p.is("func"):
+		p.next()
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		t = p.peek()
+		fn, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := pb.SearchFuncs[fn]; !ok {
+			return nil, p.errorf(t, "unknown function %q, expected eq, anyofterms, allofterms, anyoftext or alloftext", fn)
+		}
+		b.Func = &filterExpr{Op: fn}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		if err := p.search(b.Func); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf(t, "expected id or func")
+	}
+	for p.is(",") {
+		p.next()
+		if err := p.page(b); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	for p.is("@") {
+		if err := p.directive(b, false); err != nil {
+			return nil, err
+		}
+	}
+	if !p.is("{") {
+		return nil, p.errorf(p.peek(), "expected the fields of the block")
+	}
+	if b.Fields, err = p.selection(1); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (p *parser) ids() ([]string, error) {
+	if !p.is("[") {
+		id, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		return []string{id}, nil
+	}
+	p.next()
+	var ids []string
+	for {
+		id, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		if !p.is(",") {
+			break
+		}
+		p.next()
+	}
+	return ids, p.expect("]")
+}
+
+// page reads first: n or offset: n
+func (p *parser) page(b *queryBlock) error {
+	t := p.peek()
+	arg, err := p.name()
+	if err != nil {
+		return err
+	}
+	if arg != "first" && arg != "offset" {
+		return p.errorf(t, "unknown argument %q, expected first or offset", arg)
+	}
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	t = p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokName || err != nil || n < 0 {
+		return p.errorf(t, "%s should be a positive number", arg)
+	}
+	if arg == "first" {
+		b.First = n
+	} else {
+		b.Offset = n
+	}
+	return nil
+}
+
+func (p *parser) selection(depth int) ([]*queryBlock, error) {
+	if depth > maxQueryDepth {
+		return nil, p.errorf(p.peek(), "the blocks are nested more than %d deep", maxQueryDepth)
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	fields := []*queryBlock{}
+	keys := make(map[string]bool)
+	for !p.is("}") {
+		t := p.peek()
+		if t.kind == tokEOF {
+			return nil, p.errorf(t, "expected \"}\" at the end of the block")
+		}
+		f, err := p.field(depth)
+		if err != nil {
+			return nil, err
+		}
+		if f.key() == "id" {
+			return nil, p.errorf(t, "id is always answered and can not be a field")
+		}
+		if keys[f.key()] {
+			return nil, p.errorf(t, "the field %q appears twice, give it an alias", f.key())
+		}
+		keys[f.key()] = true
+		fields = append(fields, f)
+	}
+	p.next()
+	return fields, nil
+}
+
+func (p *parser) field(depth int) (*queryBlock, error) {
+	f := &queryBlock{}
+	var err error
+	if f.Alias, f.Name, err = p.aliasName(); err != nil {
+		return nil, err
+	}
+	if p.is("(") {
+		p.next()
+		for {
+			if err := p.page(f); err != nil {
+				return nil, err
+			}
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	for p.is("@") {
+		if err := p.directive(f, true); err != nil {
+			return nil, err
+		}
+	}
+	if p.is("{") {
+		if f.Fields, err = p.selection(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// directive reads @filter or, on the fields that follow edges, @facets
+func (p *parser) directive(b *queryBlock, edges bool) error {
+	p.next()
+	t := p.peek()
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	switch {
+	case name == "filter":
+		if b.Filter != nil {
+			return p.errorf(t, "a block has a single @filter, combine the conditions with and")
+		}
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		if b.Filter, err = p.or(false); err != nil {
+			return err
+		}
+	case name == "facets" && edges:
+		b.Facets = true
+		if !p.is("(") {
+			return nil
+		}
+		p.next()
+		t = p.peek()
+		if p.is("orderasc") || p.is("orderdesc") {
+			if b.OrderBy != "" {
+				return p.errorf(t, "the values are ordered by a single facet")
+			}
+			b.OrderDesc = p.next().text == "orderdesc"
+			if err := p.expect(":"); err != nil {
+				return err
+			}
+			if b.OrderBy, err = p.name(); err != nil {
+				return err
+			}
+		} else {
+			if b.FacetFilter != nil {
+				return p.errorf(t, "a field has a single facet filter, combine the conditions with and")
+			}
+			if b.FacetFilter, err = p.or(true); err != nil {
+				return err
+			}
+		}
+	case name == "facets":
+		return p.errorf(t, "@facets only applies to the fields")
+	default:
+		return p.errorf(t, "unknown directive @%s", name)
+	}
+	return p.expect(")")
+}
+
+// or reads a filter, of the facets of an edge or of a node
+func (p *parser) or(facets bool) (*filterExpr, error) {
+	e, err := p.and(facets)
+	if err != nil {
+		return nil, err
+	}
+	for p.is("or") {
+		p.next()
+		r, err := p.and(facets)
+		if err != nil {
+			return nil, err
+		}
+		e = &filterExpr{Op: "or", Args: []*filterExpr{e, r}}
+	}
+	return e, nil
+}
+
+func (p *parser) and(facets bool) (*filterExpr, error) {
+	e, err := p.factor(facets)
+	if err != nil {
+		return nil, err
+	}
+	for p.is("and") {
+		p.next()
+		r, err := p.factor(facets)
+		if err != nil {
+			return nil, err
+		}
+		e = &filterExpr{Op: "and", Args: []*filterExpr{e, r}}
+	}
+	return e, nil
+}
+
+func (p *parser) factor(facets bool) (*filterExpr, error) {
+	if p.is("not") || p.is("(") {
+		if p.depth++; p.depth > maxQueryDepth {
+			return nil, p.errorf(p.peek(), "the filter is nested more than %d deep", maxQueryDepth)
+		}
+		defer func() { p.depth-- }()
+	}
+	switch {
+	case p.is("not"):
+		p.next()
+		e, err := p.factor(facets)
+		if err != nil {
+			return nil, err
+		}
+		return &filterExpr{Op: "not", Args: []*filterExpr{e}}, nil
+	case p.is("("):
+		p.next()
+		e, err := p.or(facets)
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	t := p.peek()
+	fn, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	e := &filterExpr{Op: fn}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if facets {
+		return e, p.facetFunction(t, e)
+	}
+	switch fn {
+	case "eq":
+		if e.Relation, err = p.name(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		v, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		e.Values = []string{v}
+	case "has":
+		if e.Relation, err = p.name(); err != nil {
+			return nil, err
+		}
+	case "anyofterms", "allofterms", "anyoftext", "alloftext":
+		return e, p.search(e)
+	case "id":
+		for {
+			v, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			e.Values = append(e.Values, v)
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+	default:
+		return nil, p.errorf(t, "unknown function %q, expected eq, has, id, anyofterms, allofterms, anyoftext or alloftext", fn)
+	}
+	return e, p.expect(")")
+}
+
+// search reads the arguments of a search function, the relation and the text
+func (p *parser) search(e *filterExpr) error {
+	var err error
+	if e.Relation, err = p.name(); err != nil {
+		return err
+	}
+	if err := p.expect(","); err != nil {
+		return err
+	}
+	text, err := p.str()
+	if err != nil {
+		return err
+	}
+	e.Values = []string{text}
+	return p.expect(")")
+}
+
+// facetFunction reads the arguments of a function testing a facet
+func (p *parser) facetFunction(t token, e *filterExpr) error {
+	var err error
+	switch e.Op {
+	case "eq", "lt", "le", "gt", "ge":
+		if e.Relation, err = p.name(); err != nil {
+			return err
+		}
+		if err := p.expect(","); err != nil {
+			return err
+		}
+		if e.Literal, err = p.literal(); err != nil {
+			return err
+		}
+	case "has":
+		if e.Relation, err = p.name(); err != nil {
+			return err
+		}
+	default:
+		return p.errorf(t, "unknown function %q, expected eq, lt, le, gt, ge or has", e.Op)
+	}
+	return p.expect(")")
+}
+
+// literal reads the string, number or boolean a facet is compared to
+func (p *parser) literal() (interface{}, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokString:
+		return t.text, nil
+	case t.kind == tokName && (t.text == "true" || t.text == "false"):
+		return t.text == "true", nil
+	case t.kind == tokName:
+		if f, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, p.errorf(t, "expected a string, a number or a boolean")
+}
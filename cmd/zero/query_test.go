@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		line, col int
+		msg       string
+	}{
+		{"empty", `{}`, 1, 1, "the query has no blocks"},
+		{"unclosed query", `{ q(id: "a") { name }`, 1, 22, `expected "}" at the end of the query`},
+		{"unclosed string", "{\n  q(id: \"a) { name } }", 2, 9, "the string is not closed"},
+		{"unexpected rune", `{ q(id: "a") { name; } }`, 1, 20, `unexpected ';'`},
+		{"no start", `{ q(first: 1) { name } }`, 1, 5, "expected id or func"},
+		{"unknown argument", `{ q(id: "a", last: 1) { name } }`, 1, 14, `unknown argument "last"`},
+		{"negative first", `{ q(id: "a", first: -1) { name } }`, 1, 21, "first should be a positive number"},
+		{"no fields", `{ q(id: "a") }`, 1, 14, "expected the fields of the block"},
+		{"id field", "{\n  q(id: \"a\") {\n    id\n  }\n}", 3, 5, "id is always answered"},
+		{"unknown function", `{ q(id: "a") @filter(like(name, "x")) { name } }`, 1, 22, `unknown function "like"`},
+		{"unknown directive", `{ q(id: "a") @sort(name) { name } }`, 1, 15, "unknown directive @sort"},
+		{"facets on root", `{ q(id: "a") @facets { name } }`, 1, 15, "@facets only applies to the fields"},
+		{"two filters", `{ q(id: "a") @filter(has(a)) @filter(has(b)) { name } }`, 1, 31, "a block has a single @filter"},
+		{"trailing", `{ q(id: "a") { name } } x`, 1, 25, `unexpected "x" after the query`},
+		{"unknown search", `{ q(func: near(loc, "x")) { name } }`, 1, 11, `unknown function "near"`},
+		{"facet literal", `{ q(id: "a") { friend @facets(eq(since, [)) } }`, 1, 41, "expected a string, a number or a boolean"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseQuery(tt.query)
+			qe, ok := err.(*queryError)
+			if !ok {
+				t.Fatalf("parseQuery(%q) = %v, want a queryError", tt.query, err)
+			}
+			if qe.line != tt.line || qe.col != tt.col || !strings.Contains(qe.msg, tt.msg) {
+				t.Errorf("parseQuery(%q) = %v, want line %d column %d: %s", tt.query, err, tt.line, tt.col, tt.msg)
+			}
+		})
+	}
+}
+
+func TestParseDepth(t *testing.T) {
+	nested := func(open, close string, n int) string {
+		return `{ q(id: "a") @filter(` + strings.Repeat(open, n) + `has(a)` + strings.Repeat(close, n) + `) { name } }`
+	}
+	tests := []struct {
+		name  string
+		query string
+		ok    bool
+	}{
+		{"parentheses", nested("(", ")", maxQueryDepth), true},
+		{"too many parentheses", nested("(", ")", maxQueryDepth+1), false},
+		{"not", nested("not ", "", maxQueryDepth), true},
+		{"too many not", nested("not ", "", maxQueryDepth+1), false},
+		{"deep filter", nested("(", ")", 1<<20), false},
+		{"blocks", `{ q(id: "a") ` + strings.Repeat("{ f ", maxQueryDepth) + strings.Repeat("} ", maxQueryDepth) + `}`, true},
+		{"too many blocks", `{ q(id: "a") ` + strings.Repeat("{ f ", maxQueryDepth+1) + strings.Repeat("} ", maxQueryDepth+1) + `}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseQuery(tt.query)
+			if (err == nil) != tt.ok {
+				t.Errorf("parseQuery() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		keys  []string
+		err   string
+	}{
+		{"names", `{ q(id: "a") { name friend } }`, []string{"name", "friend"}, ""},
+		{"alias", `{ q(id: "a") { pals: friend best: friend(first: 1) } }`, []string{"pals", "best"}, ""},
+		{"duplicate field", `{ q(id: "a") { friend friend } }`, nil, `the field "friend" appears twice`},
+		{"alias clashes with a name", `{ q(id: "a") { name name: friend } }`, nil, `the field "name" appears twice`},
+		{"duplicate block", `{ q(id: "a") { name } q(id: "b") { name } }`, nil, `the block "q" appears twice`},
+		{"aliased blocks", `{ a: q(id: "a") { name } b: q(id: "b") { name } }`, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := parseQuery(tt.query)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("parseQuery() = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.keys == nil {
+				return
+			}
+			var keys []string
+			for _, f := range blocks[0].Fields {
+				keys = append(keys, f.key())
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.keys, ",") {
+				t.Errorf("keys = %v, want %v", keys, tt.keys)
+			}
+		})
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{`has(a) or has(b) and has(c)`, "or(has(a),and(has(b),has(c)))"},
+		{`has(a) and has(b) or has(c)`, "or(and(has(a),has(b)),has(c))"},
+		{`not has(a) and has(b)`, "and(not(has(a)),has(b))"},
+		{`not (has(a) and has(b))`, "not(and(has(a),has(b)))"},
+		{`(has(a) or has(b)) and has(c)`, "and(or(has(a),has(b)),has(c))"},
+		{`has(a) or has(b) or has(c)`, "or(or(has(a),has(b)),has(c))"},
+	}
+	var show func(e *filterExpr) string
+	show = func(e *filterExpr) string {
+		if len(e.Args) == 0 {
+			return e.Op + "(" + e.Relation + ")"
+		}
+		args := make([]string, len(e.Args))
+		for i, a := range e.Args {
+			args[i] = show(a)
+		}
+		return e.Op + "(" + strings.Join(args, ",") + ")"
+	}
+	for _, tt := range tests {
+		blocks, err := parseQuery(`{ q(id: "a") @filter(` + tt.filter + `) { name } }`)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.filter, err)
+		}
+		if got := show(blocks[0].Filter); got != tt.want {
+			t.Errorf("%s parsed as %s, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
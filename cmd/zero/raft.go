@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	retainSnapshotCount = 2
+	raftTimeout         = 10 * time.Second
+)
+
+// the operations that change the cluster state, every one of them
+// goes through the raft log so that all the zeros agree on the routing
+const (
+	createGroup  string = "CREATE_GROUP"
+	joinGroup    string = "JOIN_GROUP"
+	updateLeader string = "UPDATE_LEADER"
+	addPeer      string = "ADD_PEER"
+	removeNode   string = "REMOVE_NODE"
+	groupReady   string = "GROUP_READY" // the data has moved, put the group on the ring
+	setTablet    string = "SET_TABLET"  // the data has moved, route the relation the new way
+	setPredicate string = "SET_PREDICATE"
+	queueReverse string = "QUEUE_REVERSE" // reverse lists to bring in line with the edges, see reverse.go
+	reverseDone  string = "REVERSE_DONE"
+	setHealth    string = "SET_HEALTH" // the leader tells the followers how the nodes are doing
+)
+
+// zeroPeer is a member of the zero raft group, we need the grpc and http
+// addresses so that followers can forward requests to the leader
+type zeroPeer struct {
+	Id          string `json:"id"`
+	RaftAddress string `json:"raftAddress"`
+	GrpcAddress string `json:"grpcAddress"`
+	HttpAddress string `json:"httpAddress"`
+}
+
+type command struct {
+	OpType  string    `json:"opType"`
+	GroupId string    `json:"groupId,omitempty"`
+	Node    *pb.Node  `json:"node,omitempty"`
+	Peer    *zeroPeer `json:"peer,omitempty"`
+	Tablet  *tablet   `json:"tablet,omitempty"`
+	// the options of a relation
+	Predicate *predicate `json:"predicate,omitempty"`
+	// the reverse lists to update
+	Reverse *reverseTask `json:"reverse,omitempty"`
+	// node id -> health, for the nodes whose health changed
+	Health map[string]pb.Health `json:"health,omitempty"`
+}
+
+// groupRecord is the serialisable form of groupInfo
+type groupRecord struct {
+	Leader  *pb.Node `json:"leader"`
+	Members int      `json:"members"`
+	// the group is not on the ring until the partitions it takes over have moved
+	Pending bool `json:"pending,omitempty"`
+}
+
+// zeroState is everything a zero knows, it is what we snapshot
+type zeroState struct {
+	Groups  map[string]*groupRecord `json:"groups"`
+	Nodes   map[string]*pb.Node     `json:"nodes"`
+	Peers   map[string]*zeroPeer    `json:"peers"`
+	Tablets map[string]*tablet      `json:"tablets"`
+	// the relations with a schema
+	Predicates map[string]*predicate `json:"predicates"`
+	// the raft index of the last change of the schema
+	SchemaVersion uint64 `json:"schemaVersion,omitempty"`
+	// the reverse lists not updated yet
+	ReverseTasks map[string]*reverseTask `json:"reverseTasks,omitempty"`
+	// the health of the nodes as the leader last told it
+	Health map[string]pb.Health `json:"health,omitempty"`
+}
+
+type raftConfig struct {
+	id        string
+	path      string
+	addr      string
+	bootstrap bool
+}
+
+// zeroFSM applies the replicated log to the ZeroServer state
+type zeroFSM struct {
+	z      *ZeroServer
+	logger *zap.Logger
+}
+
+// Apply is called once a log entry is committed by a majority of the zeros.
+// Every operation is idempotent, the log is replayed on restart.
+func (f *zeroFSM) Apply(log *raft.Log) interface{} {
+	var c command
+	if err := json.Unmarshal(log.Data, &c); err != nil {
+		f.logger.Fatal("Failed unmarshalling Log entry, this is a bug")
+	}
+	z := f.z
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	switch c.OpType {
+	case createGroup:
+		if _, ok := z.gInfo[c.GroupId]; ok {
+			return nil
+		}
+		c.Node.GroupId = c.GroupId
+		// the first group owns everything, the others have to wait for the
+		// partitions they take over to be copied to them
+		entry := &groupInfo{
+			leader:  c.Node,
+			members: 1,
+			pending: len(z.c.c.GetMembers()) > 0,
+		}
+		if entry.pending {
+			if err := z.c.saveGroup(c.GroupId, entry.record()); err != nil {
+				return err
+			}
+		} else if err := z.c.addGroup(c.GroupId, entry.record()); err != nil {
+			return err
+		}
+		if err := z.c.saveNode(c.Node); err != nil {
+			return err
+		}
+		z.nInfo[c.Node.GetId()] = c.Node
+		z.gInfo[c.GroupId] = entry
+		z.expectHeartbeat(c.Node.GetId())
+		z.publish(pb.GroupEvent_CREATED, c.GroupId, c.Node)
+	case joinGroup:
+		entry, ok := z.gInfo[c.GroupId]
+		if !ok {
+			return errUnknownGroup
+		}
+		members := entry.members
+		if memNode, ok := z.nInfo[c.Node.GetId()]; !ok || memNode.GetGroupId() != c.GroupId {
+			members += 1
+		}
+		c.Node.GroupId = c.GroupId
+		rec := entry.record()
+		rec.Members = members
+		if err := z.c.saveGroup(c.GroupId, rec); err != nil {
+			return err
+		}
+		if err := z.c.saveNode(c.Node); err != nil {
+			return err
+		}
+		entry.members = members
+		z.nInfo[c.Node.GetId()] = c.Node
+		z.expectHeartbeat(c.Node.GetId())
+		z.publish(pb.GroupEvent_MEMBER_JOINED, c.GroupId, c.Node)
+	case updateLeader:
+		entry, ok := z.gInfo[c.Node.GetGroupId()]
+		if !ok {
+			return errUnknownGroup
+		}
+		rec := entry.record()
+		rec.Leader = c.Node
+		if err := z.c.saveGroup(c.Node.GetGroupId(), rec); err != nil {
+			return err
+		}
+		if err := z.c.saveNode(c.Node); err != nil {
+			return err
+		}
+		z.nInfo[c.Node.GetId()] = c.Node
+		entry.leader = c.Node
+		z.publish(pb.GroupEvent_LEADER_CHANGED, c.Node.GetGroupId(), c.Node)
+	case removeNode:
+		memNode, ok := z.nInfo[c.Node.GetId()]
+		if !ok {
+			return nil
+		}
+		grp := memNode.GetGroupId()
+		if entry, ok := z.gInfo[grp]; ok {
+			rec := entry.record()
+			rec.Members -= 1
+			// the group has no known leader until one of the others
+			// tells us it won the election
+			if entry.leader.GetId() == memNode.GetId() {
+				rec.Leader = nil
+			}
+			if err := z.c.saveGroup(grp, rec); err != nil {
+				return err
+			}
+			entry.members, entry.leader = rec.Members, rec.Leader
+		}
+		if err := z.c.deleteNode(memNode.GetId()); err != nil {
+			return err
+		}
+		delete(z.nInfo, memNode.GetId())
+		delete(z.status, memNode.GetId())
+		z.publish(pb.GroupEvent_MEMBER_LEFT, grp, memNode)
+	case groupReady:
+		entry, ok := z.gInfo[c.GroupId]
+		if !ok {
+			return errUnknownGroup
+		}
+		if !entry.pending {
+			return nil
+		}
+		rec := entry.record()
+		rec.Pending = false
+		if err := z.c.addGroup(c.GroupId, rec); err != nil {
+			return err
+		}
+		entry.pending = false
+		z.publish(pb.GroupEvent_READY, c.GroupId, nil)
+	case setPredicate:
+		if err := z.c.savePredicate(c.Predicate); err != nil {
+			return err
+		}
+		// the edges written before the relation was marked get their
+		// reverse edges
+		if prev, ok := z.predicates[c.Predicate.Relation]; c.Predicate.Reverse && (!ok || !prev.Reverse) {
+			task := backfillTask(c.Predicate.Relation)
+			if err := z.c.saveReverseTask(task); err != nil {
+				return err
+			}
+			z.reverseTasks[task.Id] = task
+		}
+		if c.Predicate.isDefault() {
+			delete(z.predicates, c.Predicate.Relation)
+		} else {
+			z.predicates[c.Predicate.Relation] = c.Predicate
+		}
+		z.schemaVersion = log.Index
+	case setTablet:
+		if err := z.c.saveTablet(c.Tablet); err != nil {
+			return err
+		}
+		if c.Tablet.Mode == hashMode {
+			delete(z.tablets, c.Tablet.Relation)
+		} else {
+			z.tablets[c.Tablet.Relation] = c.Tablet
+		}
+	case queueReverse:
+		if err := z.c.saveReverseTask(c.Reverse); err != nil {
+			return err
+		}
+		z.reverseTasks[c.Reverse.Id] = c.Reverse
+	case reverseDone:
+		if err := z.c.deleteReverseTask(c.Reverse.Id); err != nil {
+			return err
+		}
+		delete(z.reverseTasks, c.Reverse.Id)
+	case addPeer:
+		z.peers[c.Peer.RaftAddress] = c.Peer
+	case setHealth:
+		// the leader knows better from the heartbeats
+		if !z.isLeader() {
+			z.followHealth(c.Health)
+		}
+	default:
+		f.logger.Fatal("Unknown Operation found, could not apply")
+	}
+	return nil
+}
+
+// Snapshot copies the maps, the state is small enough to do it inline
+func (f *zeroFSM) Snapshot() (raft.FSMSnapshot, error) {
+	z := f.z
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	state := zeroState{
+		Groups:        make(map[string]*groupRecord, len(z.gInfo)),
+		Nodes:         make(map[string]*pb.Node, len(z.nInfo)),
+		Peers:         make(map[string]*zeroPeer, len(z.peers)),
+		Tablets:       make(map[string]*tablet, len(z.tablets)),
+		Predicates:    make(map[string]*predicate, len(z.predicates)),
+		SchemaVersion: z.schemaVersion,
+		ReverseTasks:  make(map[string]*reverseTask, len(z.reverseTasks)),
+		Health:        make(map[string]pb.Health, len(z.status)),
+	}
+	for k, v := range z.gInfo {
+		state.Groups[k] = v.record()
+	}
+	for k, v := range z.nInfo {
+		state.Nodes[k] = v
+	}
+	for k, v := range z.peers {
+		state.Peers[k] = v
+	}
+	for k, v := range z.tablets {
+		state.Tablets[k] = v
+	}
+	for k, v := range z.predicates {
+		state.Predicates[k] = v
+	}
+	for k, v := range z.reverseTasks {
+		state.ReverseTasks[k] = v
+	}
+	for k, v := range z.status {
+		state.Health[k] = v.health
+	}
+	return &zeroSnapshot{state: state}, nil
+}
+
+// Restore replaces the whole state, including the hash ring
+func (f *zeroFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var state zeroState
+	if err := json.NewDecoder(rc).Decode(&state); err != nil {
+		return err
+	}
+	z := f.z
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	if err := z.c.reset(&state); err != nil {
+		return err
+	}
+	z.setState(&state)
+	z.peers = state.Peers
+	z.status = make(map[string]*nodeStatus, len(state.Health))
+	z.followHealth(state.Health)
+	return nil
+}
+
+type zeroSnapshot struct {
+	state zeroState
+}
+
+func (s *zeroSnapshot) Persist(sink raft.SnapshotSink) error {
+	err := json.NewEncoder(sink).Encode(&s.state)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (*zeroSnapshot) Release() {
+}
+
+func newRaft(cfg *raftConfig, fsm raft.FSM) (*raft.Raft, error) {
+	raftCfg := raft.DefaultConfig()
+	raftCfg.LocalID = raft.ServerID(cfg.id)
+
+	snapshots, err := raft.NewFileSnapshotStore(cfg.path, retainSnapshotCount, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	raddr, err := net.ResolveTCPAddr("tcp", cfg.addr)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(cfg.addr, raddr, 3, raftTimeout, os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	boltDB, err := raftboltdb.NewBoltStore(filepath.Join(cfg.path, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	rf, err := raft.NewRaft(raftCfg, fsm, boltDB, boltDB, snapshots, transport)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.bootstrap {
+		config := raft.Configuration{Servers: []raft.Server{{
+			ID:      raft.ServerID(cfg.id),
+			Address: transport.LocalAddr(),
+		}}}
+		// fails harmlessly if we already have state
+		rf.BootstrapCluster(config)
+	}
+	return rf, nil
+}
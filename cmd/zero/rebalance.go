@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Adding a group to the ring hands it some partitions of the other groups,
+// and moves a few between the others to keep the load bounded. A new group
+// stays pending until the partitions are copied, then it is put on the ring
+// through raft so every zero routes to it at once. Placing a relation on a
+// group moves its keys the same way.
+//
+// The old owners refuse the writes to the moving keys from the start, so a
+// single copy taken while nothing changes is exact, deletes included. The
+// new owners are cleared of the keys first, a failed attempt may have left
+// some. Once the keys are routed to their new owners the old ones drop them
+// and accept writes again.
+
+const (
+	importBatch    = 256
+	rebalanceRetry = 2 * time.Second
+	// how long a tablet move waits for the rebalancer to take it
+	rebalanceWait = 5 * time.Second
+)
+
+var (
+	errNotLeader     = errors.New("not the zero leader anymore")
+	errRebalanceBusy = errors.New("the rebalancer is busy moving other keys")
+)
+
+// partitionRequest selects the keys of an alpha to export or purge
+type partitionRequest struct {
+	Partitions     []int    `json:"partitions,omitempty"`
+	PartitionCount int      `json:"partitionCount,omitempty"`
+	Relation       string   `json:"relation,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	// an export starts past this key, to resume one
+	After string `json:"after,omitempty"`
+}
+
+// rebalanceJob is either a pending group to put on the ring, a relation to
+// place or keys left on their old group to drop, they are run one at a time
+// since they all move keys around
+type rebalanceJob struct {
+	group  string
+	tablet *tablet
+	purge  *keyMove
+	done   chan error
+}
+
+// keyValue is a line of an alpha export
+type keyValue struct {
+	Key   string      `json:"key,omitempty"`
+	Value []edgeValue `json:"value,omitempty"`
+	Done  bool        `json:"done,omitempty"`
+}
+
+func (z *ZeroServer) scheduleRebalance(grp string) {
+	go func() { z.rebalanceCh <- &rebalanceJob{group: grp} }()
+}
+
+// schedulePurge drops the keys from the group they moved out of, they are
+// routed to their new group already so only the copy left behind goes
+func (z *ZeroServer) schedulePurge(m keyMove) {
+	go func() { z.rebalanceCh <- &rebalanceJob{purge: &m} }()
+}
+
+// placeTablet moves the keys of the relation and waits for it to be done,
+// or for ctx. The rebalancer may retry a pending group for a long time, the
+// move is given up when it is not taken within rebalanceWait. A move that
+// started goes on without the caller.
+func (z *ZeroServer) placeTablet(ctx context.Context, t *tablet) error {
+	job := &rebalanceJob{tablet: t, done: make(chan error, 1)}
+	wait := time.NewTimer(rebalanceWait)
+	defer wait.Stop()
+	select {
+	case z.rebalanceCh <- job:
+	case <-wait.C:
+		return errRebalanceBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rebalancer runs the jobs, a pending group is retried until it is on the
+// ring and a purge until it is done, while a tablet move is reported back
+// to whoever asked for it
+func (z *ZeroServer) rebalancer() {
+	for job := range z.rebalanceCh {
+		if job.tablet != nil {
+			job.done <- z.moveTablet(job.tablet)
+			continue
+		}
+		for {
+			grp := job.group
+			var err error
+			if job.purge != nil {
+				grp = job.purge.from
+				err = z.alphaPost(grp, "/admin/purge", job.purge.keys, nil)
+			} else {
+				err = z.rebalance(grp)
+			}
+			if err == nil || err == errNotLeader {
+				break
+			}
+			z.logger.Error("Could not rebalance, retrying", zap.String("group", grp), zap.Error(err))
+			time.Sleep(rebalanceRetry)
+		}
+	}
+}
+
+func (z *ZeroServer) rebalance(grp string) error {
+	if !z.isLeader() {
+		return errNotLeader
+	}
+	z.mut.Lock()
+	entry, ok := z.gInfo[grp]
+	if !ok || !entry.pending {
+		z.mut.Unlock()
+		return nil
+	}
+	changes := z.c.partitionMoves(grp)
+	// the relations placed on a group do not follow the ring
+	exclude := z.tabletRelations()
+	z.mut.Unlock()
+
+	moves := make([]keyMove, 0, len(changes))
+	for c, parts := range changes {
+		moves = append(moves, keyMove{
+			from: c.from,
+			to:   c.to,
+			keys: &partitionRequest{Partitions: parts, PartitionCount: z.c.cfg.PartitionCount, Exclude: exclude},
+		})
+	}
+	z.logger.Info("Moving partitions for the new group", zap.String("group", grp), zap.Int("moves", len(moves)))
+	err := z.moveKeys(moves, func() error {
+		return z.propose(&command{OpType: groupReady, GroupId: grp})
+	})
+	if err != nil {
+		return err
+	}
+	z.logger.Info("The new group is serving its partitions", zap.String("group", grp))
+	return nil
+}
+
+// keyMove is the keys going from a group to another
+type keyMove struct {
+	from, to string
+	keys     *partitionRequest
+}
+
+// union selects the keys of both requests, they are for the same relations
+func union(a, b *partitionRequest) *partitionRequest {
+	if a == nil {
+		cp := *b
+		cp.Partitions = append([]int(nil), b.Partitions...)
+		return &cp
+	}
+	if len(a.Partitions) == 0 || len(b.Partitions) == 0 {
+		// one of them selects every partition
+		a.Partitions, a.PartitionCount = nil, 0
+		return a
+	}
+	a.Partitions = append(a.Partitions, b.Partitions...)
+	return a
+}
+
+// moveKeys copies the keys to their new groups while their old groups
+// refuse writes to them, cutover routes them to the new groups and then the
+// old groups drop them. The old groups accept writes again whatever happens.
+func (z *ZeroServer) moveKeys(moves []keyMove, cutover func() error) (err error) {
+	frozen := make(map[string]*partitionRequest)
+	for _, m := range moves {
+		frozen[m.from] = union(frozen[m.from], m.keys)
+	}
+	defer func() {
+		for from := range frozen {
+			if terr := z.alphaPost(from, "/admin/thaw", struct{}{}, nil); terr != nil {
+				z.logger.Error("Could not thaw the moved keys", zap.String("group", from), zap.Error(terr))
+				if err == nil {
+					err = terr
+				}
+			}
+		}
+	}()
+	for _, m := range moves {
+		// a move that could not finish may have left them frozen
+		if frozen[m.to] == nil {
+			if err := z.alphaPost(m.to, "/admin/thaw", struct{}{}, nil); err != nil {
+				return err
+			}
+		}
+	}
+	for from, req := range frozen {
+		if err := z.alphaPost(from, "/admin/freeze", req, nil); err != nil {
+			return err
+		}
+	}
+	for _, m := range moves {
+		if err := z.alphaPost(m.to, "/admin/purge", m.keys, nil); err != nil {
+			return err
+		}
+		if err := z.copyKeys(m.from, m.to, m.keys); err != nil {
+			return err
+		}
+	}
+	if err := cutover(); err != nil {
+		return err
+	}
+	// the move is done, a copy left behind is dropped later
+	for _, m := range moves {
+		if err := z.alphaPost(m.from, "/admin/purge", m.keys, nil); err != nil {
+			z.logger.Error("Could not drop the moved keys, retrying", zap.String("group", m.from), zap.Error(err))
+			z.schedulePurge(m)
+		}
+	}
+	return nil
+}
+
+// copyKeys streams the keys selected by req out of the leader of a group and
+// writes them in batches into the other group
+func (z *ZeroServer) copyKeys(from, to string, req *partitionRequest) error {
+	batch := make(map[string][]edgeValue, importBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := z.alphaPost(to, "/admin/import", map[string]interface{}{"batch": batch}, nil)
+		batch = make(map[string][]edgeValue, importBatch)
+		return err
+	}
+	var done bool
+	err := z.alphaPost(from, "/admin/export", req, func(body io.Reader) error {
+		dec := json.NewDecoder(body)
+		for {
+			var kv keyValue
+			if err := dec.Decode(&kv); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if kv.Done {
+				done = true
+				continue
+			}
+			batch[kv.Key] = kv.Value
+			if len(batch) >= importBatch {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !done {
+		return fmt.Errorf("the export from group %s was cut short", from)
+	}
+	return flush()
+}
+
+// alphaPost sends the request to the leader of the group, read consumes the
+// response body when it is not nil
+func (z *ZeroServer) alphaPost(grp, path string, msg interface{}, read func(io.Reader) error) error {
+	if !z.isLeader() {
+		return errNotLeader
+	}
+	leader, err := z.leaderOf(grp)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	// an export can take a while, it is not bound by the client timeout
+	client := &http.Client{Transport: z.client.Transport}
+	resp, err := client.Post(fmt.Sprintf("http://%s%s", leader.GetHttpAddress(), path), "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s on group %s answered with status %d", path, grp, resp.StatusCode)
+	}
+	if read != nil {
+		return read(resp.Body)
+	}
+	return nil
+}
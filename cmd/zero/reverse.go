@@ -0,0 +1,597 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/hashicorp/go-uuid"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A relation marked @reverse, PUT /schema/<relation> {"reverse": true},
+// keeps the list ~relation of every value up to date: writing A.friend = B
+// adds A to B%~friend in the group that owns that key. The zero maintains the
+// reverse lists for the writes it passes on, a write sent straight to an
+// alpha only changes the forward list.
+//
+// The edge and its reverse edge live in different groups. A write records
+// the values it touches as a task in the zero raft log before it goes to the
+// group, and once it is answered brings the reverse edges of these values in
+// line with what the relation holds. A task the write could not finish is
+// run again by the leader until it is done.
+//
+// Marking a relation queues a backfill of its reverse lists. It first exports
+// the relation group by group and adds the reverse edges missing for each
+// batch of keys, then exports ~relation and removes the reverse edges whose
+// edge is gone. The lists are never dropped, readers see them fill up. The
+// task records the last key done in the raft log after every batch so a new
+// leader resumes it. The leader updates the reverse lists of a relation one
+// batch or one write at a time, reading the edges again first, so a write
+// made during the backfill is not undone by it.
+
+const (
+	reversePrefix = "~"
+	reverseRetry  = 2 * time.Second
+)
+
+// reverseTask is the values of node%relation whose reverse edges may be out
+// of line, or a relation whose reverse lists are rebuilt when the node is
+// empty
+type reverseTask struct {
+	Id       string   `json:"id"`
+	Node     string   `json:"node,omitempty"`
+	Relation string   `json:"relation"`
+	Values   []string `json:"values,omitempty"`
+	// the leader leaves a task to the write that queued it for a while
+	Queued time.Time `json:"queued,omitempty"`
+	// how far a backfill got, the phase, adding the missing reverse edges
+	// or removing the stale ones, the groups the phase exports, how many
+	// of them are done and the last key done in the next one
+	Phase  int      `json:"phase,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Done   int      `json:"done,omitempty"`
+	After  string   `json:"after,omitempty"`
+}
+
+const (
+	backfillAdd = iota
+	backfillRemove
+	backfillDone
+)
+
+// backfillBatch is the keys a backfill exports before it updates their
+// reverse lists and records how far it got
+const backfillBatch = 256
+
+// backfillTask rebuilds the reverse lists of the relation
+func backfillTask(relation string) *reverseTask {
+	return &reverseTask{Id: "backfill/" + relation, Relation: relation}
+}
+
+// isReverse tells if the reverse edges of the relation are maintained
+func (z *ZeroServer) isReverse(relation string) bool {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	return z.getPredicate(relation).Reverse
+}
+
+// isSingle tells if the relation holds a single value
+func (z *ZeroServer) isSingle(relation string) bool {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	return z.getPredicate(relation).Cardinality == cardinalityOne
+}
+
+// reverseRelations returns the relations marked @reverse
+func (z *ZeroServer) reverseRelations() []string {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	relations := make([]string, 0, len(z.predicates))
+	for r, p := range z.predicates {
+		if p.Reverse {
+			relations = append(relations, r)
+		}
+	}
+	sort.Strings(relations)
+	return relations
+}
+
+// keyRequest sends a request for the key to the group owning it, path is
+// id, relation and optionally a value
+func (s *httpService) keyRequest(ctx context.Context, method string, query url.Values, body interface{}, path ...string) (*http.Response, error) {
+	grp, err := s.server.groupFor(path[0], path[1])
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	if body != nil {
+		if b, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	for i := range path {
+		path[i] = url.PathEscape(path[i])
+	}
+	uri := "/" + strings.Join(path, "/")
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp := s.send(req, b, grp)
+	if resp == nil {
+		return nil, fmt.Errorf("could not reach group %s", grp)
+	}
+	return resp, nil
+}
+
+// values returns the values of id%relation with their facets read at the
+// given consistency, the default one when empty, none when the key does not
+// exist
+func (s *httpService) values(ctx context.Context, id, relation, consistency string) ([]edgeValue, error) {
+	var query url.Values
+	if consistency != "" {
+		query = url.Values{"consistency": {consistency}}
+	}
+	resp, err := s.keyRequest(ctx, http.MethodGet, query, nil, id, relation)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("reading %s%s%s answered %d", id, SEPARATOR, relation, resp.StatusCode)
+	}
+	var vals []edgeValue
+	if err := json.NewDecoder(resp.Body).Decode(&vals); err != nil {
+		return nil, err
+	}
+	return vals, nil
+}
+
+// edge is one value of id%relation
+type edge struct {
+	id, relation, value string
+	facets              map[string]interface{}
+}
+
+// removeEdge removes the value from id%relation, it is fine if it is not there
+func (s *httpService) removeEdge(ctx context.Context, e edge) error {
+	resp, err := s.keyRequest(ctx, http.MethodDelete, nil, nil, e.id, e.relation, e.value)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("removing from %s%s%s answered %d", e.id, SEPARATOR, e.relation, resp.StatusCode)
+	}
+	return nil
+}
+
+// reverseWrite passes a write to a relation marked @reverse on to its group
+// and then updates the reverse lists of the values it touched, the forward
+// write is answered once they are updated or left to the leader
+func (s *httpService) reverseWrite(w http.ResponseWriter, r *http.Request, grp string) {
+	vars := mux.Vars(r)
+	id, relation := vars["id"], vars["relation"]
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		s.writeError(w, 400, "Could not open request body")
+		return
+	}
+	// the task goes through the raft log
+	if s.forwardToLeader(w, r, body) {
+		return
+	}
+	ctx := r.Context()
+	// the values whose reverse list changes
+	var values []string
+	switch {
+	case r.Method == http.MethodPut:
+		var req edgeObject
+		// a malformed body is refused by the alpha
+		if json.Unmarshal(body, &req) == nil && req.Value != "" {
+			values = append(values, req.Value)
+		}
+		if s.server.isSingle(relation) {
+			// the value it holds is replaced
+			cur, err := s.values(ctx, id, relation, "")
+			if err != nil {
+				s.logger.Error("Could not read the relation", zap.Error(err))
+				s.writeError(w, 502, "Could not read the value to replace")
+				return
+			}
+			for _, v := range cur {
+				values = append(values, v.Value)
+			}
+		}
+	case vars["value"] != "":
+		values = []string{vars["value"]}
+	default:
+		// the whole relation goes, read what it holds first
+		cur, err := s.values(ctx, id, relation, "")
+		if err != nil {
+			s.logger.Error("Could not read the relation", zap.Error(err))
+			s.writeError(w, 502, "Could not read the relation to delete")
+			return
+		}
+		for _, v := range cur {
+			values = append(values, v.Value)
+		}
+	}
+	taskId, err := uuid.GenerateUUID()
+	if err != nil {
+		s.writeError(w, 500, "Could not queue the reverse edges")
+		return
+	}
+	task := &reverseTask{Id: taskId, Node: id, Relation: relation, Values: values, Queued: time.Now()}
+	if err := s.server.propose(&command{OpType: queueReverse, Reverse: task}); err != nil {
+		s.logger.Error("Could not queue the reverse edges", zap.Error(err))
+		s.writeError(w, 500, "Could not queue the reverse edges: "+err.Error())
+		return
+	}
+	resp := s.send(r, body, grp)
+	// whatever the group answered, the reverse edges follow what the
+	// relation holds now
+	s.runReverseTask(ctx, task)
+	if resp == nil {
+		s.writeError(w, 502, "Could not reach the group owning the key")
+		return
+	}
+	defer resp.Body.Close()
+	s.copyResponse(w, resp)
+}
+
+// runReverseTask updates the reverse lists of the task and drops it, it is
+// left for the leader to run again when it fails
+func (s *httpService) runReverseTask(ctx context.Context, t *reverseTask) {
+	if err := s.reconcile(ctx, t); err != nil {
+		s.logger.Info("Could not update the reverse edges, the leader will retry",
+			zap.String("relation", t.Relation), zap.String("node", t.Node), zap.Error(err))
+		return
+	}
+	if err := s.server.propose(&command{OpType: reverseDone, Reverse: &reverseTask{Id: t.Id}}); err != nil {
+		s.logger.Info("Could not drop the reverse task", zap.String("task", t.Id), zap.Error(err))
+	}
+}
+
+// reconcile sets the node in the reverse list of the values the relation
+// holds, with the facets of the edge, and removes it from the others
+func (s *httpService) reconcile(ctx context.Context, t *reverseTask) error {
+	if !s.server.isReverse(t.Relation) {
+		// unmarked in the meantime, the lists are not maintained anymore
+		return nil
+	}
+	if t.Node == "" {
+		return s.backfill(ctx, t)
+	}
+	s.server.reverseMut.Lock()
+	defer s.server.reverseMut.Unlock()
+	cur, err := s.values(ctx, t.Node, t.Relation, "")
+	if err != nil {
+		return err
+	}
+	held := make(map[string]edgeValue, len(cur))
+	for _, v := range cur {
+		held[v.Value] = v
+	}
+	// the node is removed and added back with the facets of the edge, an
+	// add alone would keep the facets the edge no longer has
+	remove := make(map[queryKey][]string)
+	add := make(map[queryKey][]edgeValue)
+	for _, v := range t.Values {
+		k := queryKey{Id: v, Relation: reversePrefix + t.Relation}
+		remove[k] = []string{t.Node}
+		if fv, ok := held[v]; ok {
+			add[k] = []edgeValue{{Value: t.Node, Facets: fv.Facets}}
+		}
+	}
+	return s.editKeys(remove, add)
+}
+
+// backfill brings the reverse lists of the relation in line with its edges,
+// from where the task got
+func (s *httpService) backfill(ctx context.Context, task *reverseTask) error {
+	t := *task
+	relation := t.Relation
+	if t.Phase == backfillAdd && t.Done == 0 && t.After == "" {
+		s.logger.Info("Backfilling the reverse lists", zap.String("relation", relation))
+	}
+	for t.Phase < backfillDone {
+		exported := relation
+		if t.Phase == backfillRemove {
+			exported = reversePrefix + relation
+		}
+		grps := s.server.relationGroups(exported)
+		sort.Strings(grps)
+		if strings.Join(grps, ",") != strings.Join(t.Groups, ",") {
+			// the keys moved between groups, the phase starts over
+			t.Groups, t.Done, t.After = grps, 0, ""
+		}
+		for t.Done < len(t.Groups) {
+			if err := s.backfillGroup(ctx, &t, exported); err != nil {
+				return err
+			}
+			t.Done, t.After = t.Done+1, ""
+			if err := s.saveBackfill(&t); err != nil {
+				return err
+			}
+		}
+		t.Phase, t.Groups, t.Done = t.Phase+1, nil, 0
+		if err := s.saveBackfill(&t); err != nil {
+			return err
+		}
+	}
+	s.logger.Info("Backfilled the reverse lists", zap.String("relation", relation))
+	return nil
+}
+
+// saveBackfill records how far the backfill got
+func (s *httpService) saveBackfill(t *reverseTask) error {
+	cp := *t
+	return s.server.propose(&command{OpType: queueReverse, Reverse: &cp})
+}
+
+// backfillGroup exports the keys of the group past t.After a batch at a time
+func (s *httpService) backfillGroup(ctx context.Context, t *reverseTask, exported string) error {
+	grp := t.Groups[t.Done]
+	var batch []keyValue
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var err error
+		if t.Phase == backfillAdd {
+			err = s.addMissing(ctx, t.Relation, batch)
+		} else {
+			err = s.removeStale(ctx, t.Relation, batch)
+		}
+		if err != nil {
+			return err
+		}
+		t.After = batch[len(batch)-1].Key
+		batch = batch[:0]
+		return s.saveBackfill(t)
+	}
+	var done bool
+	req := &partitionRequest{Relation: exported, After: t.After}
+	err := s.server.alphaPost(grp, "/admin/export", req, func(body io.Reader) error {
+		dec := json.NewDecoder(body)
+		for {
+			var kv keyValue
+			if err := dec.Decode(&kv); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if kv.Done {
+				done = true
+				continue
+			}
+			batch = append(batch, kv)
+			if len(batch) >= backfillBatch {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !done {
+		return fmt.Errorf("the export from group %s was cut short", grp)
+	}
+	return flush()
+}
+
+// addMissing adds the reverse edges the keys of the relation lack, or whose
+// facets differ from the edge
+func (s *httpService) addMissing(ctx context.Context, relation string, batch []keyValue) error {
+	s.server.reverseMut.Lock()
+	defer s.server.reverseMut.Unlock()
+	keys := make([]queryKey, len(batch))
+	for i, kv := range batch {
+		keys[i] = queryKey{Id: strings.TrimSuffix(kv.Key, SEPARATOR+relation), Relation: relation}
+	}
+	// the export may be behind the writes made since
+	edges, err := s.readKeys(ctx, keys, "")
+	if err != nil {
+		return err
+	}
+	var targets []queryKey
+	for _, k := range keys {
+		for _, v := range edges[k] {
+			targets = append(targets, queryKey{Id: v.Value, Relation: reversePrefix + relation})
+		}
+	}
+	lists, err := s.readKeys(ctx, targets, "")
+	if err != nil {
+		return err
+	}
+	remove := make(map[queryKey][]string)
+	add := make(map[queryKey][]edgeValue)
+	for _, k := range keys {
+		for _, v := range edges[k] {
+			target := queryKey{Id: v.Value, Relation: reversePrefix + relation}
+			want := edgeValue{Value: k.Id, Facets: v.Facets}
+			switch have, ok := findValue(lists[target], k.Id); {
+			case !ok:
+				add[target] = append(add[target], want)
+			case !sameFacets(have.Facets, want.Facets):
+				remove[target] = append(remove[target], k.Id)
+				add[target] = append(add[target], want)
+			}
+		}
+	}
+	return s.editKeys(remove, add)
+}
+
+// removeStale removes from the reverse lists the nodes whose edge is gone
+func (s *httpService) removeStale(ctx context.Context, relation string, batch []keyValue) error {
+	s.server.reverseMut.Lock()
+	defer s.server.reverseMut.Unlock()
+	reverse := reversePrefix + relation
+	keys := make([]queryKey, len(batch))
+	for i, kv := range batch {
+		keys[i] = queryKey{Id: strings.TrimSuffix(kv.Key, SEPARATOR+reverse), Relation: reverse}
+	}
+	lists, err := s.readKeys(ctx, keys, "")
+	if err != nil {
+		return err
+	}
+	var sources []queryKey
+	for _, k := range keys {
+		for _, v := range lists[k] {
+			sources = append(sources, queryKey{Id: v.Value, Relation: relation})
+		}
+	}
+	edges, err := s.readKeys(ctx, sources, "")
+	if err != nil {
+		return err
+	}
+	remove := make(map[queryKey][]string)
+	for _, k := range keys {
+		for _, v := range lists[k] {
+			if _, ok := findValue(edges[queryKey{Id: v.Value, Relation: relation}], k.Id); !ok {
+				remove[k] = append(remove[k], v.Value)
+			}
+		}
+	}
+	return s.editKeys(remove, nil)
+}
+
+func findValue(vals []edgeValue, value string) (edgeValue, bool) {
+	for _, v := range vals {
+		if v.Value == value {
+			return v, true
+		}
+	}
+	return edgeValue{}, false
+}
+
+func sameFacets(a, b map[string]interface{}) bool {
+	return (len(a) == 0 && len(b) == 0) || reflect.DeepEqual(a, b)
+}
+
+// editKeys removes and then adds values of keys, a request to each group
+// owning some of them
+func (s *httpService) editKeys(remove map[queryKey][]string, add map[queryKey][]edgeValue) error {
+	type edit struct {
+		Remove map[string][]string    `json:"remove,omitempty"`
+		Add    map[string][]edgeValue `json:"add,omitempty"`
+	}
+	edits := make(map[string]*edit)
+	editOf := func(k queryKey) (*edit, error) {
+		grp, err := s.server.groupFor(k.Id, k.Relation)
+		if err != nil {
+			return nil, err
+		}
+		if edits[grp] == nil {
+			edits[grp] = &edit{Remove: make(map[string][]string), Add: make(map[string][]edgeValue)}
+		}
+		return edits[grp], nil
+	}
+	for k, vals := range remove {
+		e, err := editOf(k)
+		if err != nil {
+			return err
+		}
+		e.Remove[k.Id+SEPARATOR+k.Relation] = vals
+	}
+	for k, vals := range add {
+		e, err := editOf(k)
+		if err != nil {
+			return err
+		}
+		e.Add[k.Id+SEPARATOR+k.Relation] = vals
+	}
+	for grp, e := range edits {
+		if err := s.server.alphaPost(grp, "/admin/edges", e, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relationGroups returns the groups holding keys of the relation
+func (z *ZeroServer) relationGroups(relation string) []string {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	if t := z.getTablet(relation); t.Mode == tabletMode {
+		return []string{t.Group}
+	}
+	grps := make([]string, 0, len(z.gInfo))
+	for id := range z.gInfo {
+		grps = append(grps, id)
+	}
+	return grps
+}
+
+// pendingReverse returns the tasks queued a while ago, the newer ones are
+// still run by the writes that queued them
+func (z *ZeroServer) pendingReverse() []*reverseTask {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	var tasks []*reverseTask
+	for _, t := range z.reverseTasks {
+		if time.Since(t.Queued) >= reverseRetry {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// reverser runs the reverse tasks left over on the leader, including the
+// ones queued under a previous leader
+func (s *httpService) reverser() {
+	ticker := time.NewTicker(reverseRetry)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !s.server.isLeader() {
+			continue
+		}
+		for _, t := range s.server.pendingReverse() {
+			s.runReverseTask(context.Background(), t)
+		}
+	}
+}
+
+// reverseEdges returns the edges to remove from other keys once the node is
+// deleted, the reverse edges of its values and the forward edges pointing
+// to it
+func (s *httpService) reverseEdges(ctx context.Context, id string) ([]edge, error) {
+	var edges []edge
+	for _, relation := range s.server.reverseRelations() {
+		targets, err := s.values(ctx, id, relation, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range targets {
+			edges = append(edges, edge{id: v.Value, relation: reversePrefix + relation, value: id})
+		}
+		sources, err := s.values(ctx, id, reversePrefix+relation, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range sources {
+			edges = append(edges, edge{id: v.Value, relation: relation, value: id})
+		}
+	}
+	return edges, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"go.uber.org/zap"
+)
+
+// fakeAlpha holds the keys of a group and answers the reads, the edits and
+// the exports the zero sends while it maintains the reverse lists
+type fakeAlpha struct {
+	mut  sync.Mutex
+	data map[string][]edgeValue
+	// the After of every export asked for
+	exports []string
+	// the next export stops after that many keys, without its done marker
+	cut int
+}
+
+func (a *fakeAlpha) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	switch r.URL.Path {
+	case "/admin/edges":
+		var msg struct {
+			Remove map[string][]string    `json:"remove"`
+			Add    map[string][]edgeValue `json:"add"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for k, vals := range msg.Remove {
+			for _, v := range vals {
+				a.data[k] = without(a.data[k], v)
+			}
+			if len(a.data[k]) == 0 {
+				delete(a.data, k)
+			}
+		}
+		for k, vals := range msg.Add {
+			a.data[k] = append(a.data[k], vals...)
+		}
+	case "/admin/export":
+		var req partitionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		a.exports = append(a.exports, req.After)
+		var keys []string
+		for k := range a.data {
+			if strings.HasSuffix(k, SEPARATOR+req.Relation) && k > req.After {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		enc := json.NewEncoder(w)
+		for i, k := range keys {
+			if a.cut > 0 && i == a.cut {
+				a.cut = 0
+				return
+			}
+			enc.Encode(&keyValue{Key: k, Value: a.data[k]})
+		}
+		enc.Encode(&keyValue{Done: true})
+	case batchPath:
+		var req struct {
+			Keys []queryKey `json:"keys"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		values := make([][]edgeValue, len(req.Keys))
+		for i, k := range req.Keys {
+			values[i] = a.data[k.Id+SEPARATOR+k.Relation]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"values": values})
+	default:
+		path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if r.Method != http.MethodGet || len(path) != 2 {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		vals, ok := a.data[path[0]+SEPARATOR+path[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(vals)
+	}
+}
+
+func without(vals []edgeValue, value string) []edgeValue {
+	var out []edgeValue
+	for _, v := range vals {
+		if v.Value != value {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// newTestReverse starts a zero leading one group served by the fake alpha,
+// with friend marked @reverse
+func newTestReverse(t *testing.T, data map[string][]edgeValue) (*httpService, *fakeAlpha) {
+	t.Helper()
+	alpha := &fakeAlpha{data: data}
+	srv := httptest.NewServer(alpha)
+	t.Cleanup(srv.Close)
+	z := newTestZero(t)
+	node := &pb.Node{Id: "a1", HttpAddress: strings.TrimPrefix(srv.URL, "http://")}
+	if err := z.propose(&command{OpType: createGroup, GroupId: "g1", Node: node}); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.propose(&command{OpType: setPredicate, Predicate: &predicate{Relation: "friend", Reverse: true}}); err != nil {
+		t.Fatal(err)
+	}
+	s := &httpService{logger: zap.NewNop(), server: z, c: z.c, client: &http.Client{Timeout: proxyTimeout}}
+	return s, alpha
+}
+
+func TestReconcile(t *testing.T) {
+	since := map[string]interface{}{"since": "2020"}
+	s, alpha := newTestReverse(t, map[string][]edgeValue{
+		"alice%friend":  {{Value: "bob", Facets: since}},
+		"carol%~friend": {{Value: "alice"}, {Value: "dave"}},
+	})
+	// alice.friend went from carol to bob
+	task := &reverseTask{Id: "t1", Node: "alice", Relation: "friend", Values: []string{"bob", "carol"}}
+	for i := 0; i < 2; i++ {
+		if err := s.reconcile(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string][]edgeValue{
+		"alice%friend":  {{Value: "bob", Facets: since}},
+		"bob%~friend":   {{Value: "alice", Facets: since}},
+		"carol%~friend": {{Value: "dave"}},
+	}
+	if !reflect.DeepEqual(alpha.data, want) {
+		t.Errorf("the group holds %v, want %v", alpha.data, want)
+	}
+}
+
+func TestBackfillResume(t *testing.T) {
+	const count = backfillBatch + 50
+	data := map[string][]edgeValue{
+		// no node holds ghost as a friend anymore
+		"hub%~friend": {{Value: "ghost"}},
+	}
+	var want []string
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("n%03d", i)
+		data[id+SEPARATOR+"friend"] = []edgeValue{{Value: "hub"}}
+		want = append(want, id)
+	}
+	// a few reverse edges were written before the backfill
+	data["hub%~friend"] = append(data["hub%~friend"], edgeValue{Value: "n000"}, edgeValue{Value: "n300"})
+	s, alpha := newTestReverse(t, data)
+	// the export of the first group stops past the first batch
+	alpha.cut = backfillBatch + 10
+
+	z := s.server
+	id := backfillTask("friend").Id
+	z.mut.Lock()
+	task := z.reverseTasks[id]
+	z.mut.Unlock()
+	if err := s.reconcile(context.Background(), task); err == nil {
+		t.Fatal("the backfill went through the export cut short")
+	}
+	z.mut.Lock()
+	task = z.reverseTasks[id]
+	z.mut.Unlock()
+	last := fmt.Sprintf("n%03d%sfriend", backfillBatch-1, SEPARATOR)
+	if task.Phase != backfillAdd || task.Done != 0 || task.After != last {
+		t.Fatalf("the backfill stopped at phase %d, group %d, after %q, want the first group after %q",
+			task.Phase, task.Done, task.After, last)
+	}
+
+	if err := s.reconcile(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+	if alpha.exports[1] != last {
+		t.Errorf("the backfill resumed after %q, want %q", alpha.exports[1], last)
+	}
+	var got []string
+	for _, v := range alpha.data["hub%~friend"] {
+		got = append(got, v.Value)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hub%%~friend holds %v, want %v", got, want)
+	}
+}
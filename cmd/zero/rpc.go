@@ -1,13 +1,28 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	pb "example.com/graphd/cmd/zero/grpc"
+	"fmt"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/raft"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
-	"math"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"sort"
 	"sync"
+	"time"
+)
+
+var (
+	errUnknownGroup = errors.New("unknown group")
+	errNoLeader     = status.Error(codes.Unavailable, "zero has no leader")
 )
 
 // zero accepts rpc responses from the multiple alpha nodes
@@ -15,142 +30,431 @@ import (
 type groupInfo struct {
 	leader  *pb.Node
 	members int
+	pending bool
+}
+
+func (g *groupInfo) record() *groupRecord {
+	return &groupRecord{Leader: g.leader, Members: g.members, Pending: g.pending}
 }
 
 // ZeroServer this handles the grpc request to the zero
 // this might need to be exported
 type ZeroServer struct {
-	mut    sync.Mutex
-	gInfo  map[string]*groupInfo
-	nInfo  map[string]*pb.Node
-	Server *grpc.Server
-	logger *zap.Logger
-	c      *consistentHashHandler
+	mut   sync.Mutex
+	gInfo map[string]*groupInfo
+	nInfo map[string]*pb.Node
+	peers map[string]*zeroPeer // raft address -> zero peer
+	// the relations placed on a single group
+	tablets map[string]*tablet
+	// the schema of the relations that have one
+	predicates    map[string]*predicate
+	schemaVersion uint64
+	// the reverse lists left to update
+	reverseTasks map[string]*reverseTask
+	// held on the leader while it updates reverse lists, see reverse.go
+	reverseMut sync.Mutex
+	// held on the leader while it replicates the health, see shareHealth
+	shareMut sync.Mutex
+	// decisions are made on the leader, serialise them so that two
+	// concurrent joins do not pick from the same view of the groups
+	leaderMut sync.Mutex
+	raft      *raft.Raft
+	self      *zeroPeer
+	conns     map[string]*grpc.ClientConn // grpc address -> conn to a peer
+	client    *http.Client                // to talk to the alphas
+	// the open WatchGroups streams
+	watchers    map[uint64]chan *pb.GroupEvent
+	nextWatcher uint64
+	// the number of nodes a group is filled up to before a new one is started
+	replicas int
+	// strict refuses the nodes that would share a failure domain in their group
+	placement string
+	// the pending groups waiting for their data
+	rebalanceCh chan *rebalanceJob
+	// what the heartbeats told us, the followers only know the health
+	status         map[string]*nodeStatus
+	since          time.Time
+	suspectTimeout time.Duration
+	deadTimeout    time.Duration
+	Server         *grpc.Server
+	logger         *zap.Logger
+	c              *consistentHashHandler
 	pb.UnimplementedZeroServer
 }
 
-func newZeroServer(logger *zap.Logger, ch *consistentHashHandler) (*ZeroServer, error) {
+func newZeroServer(logger *zap.Logger, ch *consistentHashHandler, self *zeroPeer) (*ZeroServer, error) {
 	return &ZeroServer{
-		gInfo:  make(map[string]*groupInfo),
-		nInfo:  make(map[string]*pb.Node),
-		Server: grpc.NewServer(),
-		logger: logger,
-		c:      ch,
+		gInfo:        make(map[string]*groupInfo),
+		nInfo:        make(map[string]*pb.Node),
+		peers:        make(map[string]*zeroPeer),
+		tablets:      make(map[string]*tablet),
+		predicates:   make(map[string]*predicate),
+		reverseTasks: make(map[string]*reverseTask),
+		self:         self,
+		conns:        make(map[string]*grpc.ClientConn),
+		client:       &http.Client{Timeout: raftTimeout},
+		watchers:     make(map[uint64]chan *pb.GroupEvent),
+		rebalanceCh:  make(chan *rebalanceJob),
+		status:       make(map[string]*nodeStatus),
+		since:        time.Now(),
+		// the defaults, main sets them from the flags
+		replicas:       defaultReplicas,
+		placement:      placementWarn,
+		suspectTimeout: defaultSuspectTimeout,
+		deadTimeout:    defaultDeadTimeout,
+		Server:         grpc.NewServer(),
+		logger:         logger,
+		c:              ch,
 	}, nil
 }
 
-func (z *ZeroServer) CreateAGroup(ctx context.Context, node *pb.Node) (*pb.Group, error) {
-	z.logger.Info("node asking to create a group")
-	group := groupInfo{
-		leader:  node,
-		members: 1,
+// setState replaces the group, node, tablet, predicate and reverse task tables, the caller holds z.mut
+func (z *ZeroServer) setState(state *zeroState) {
+	z.gInfo = make(map[string]*groupInfo, len(state.Groups))
+	for k, v := range state.Groups {
+		z.gInfo[k] = &groupInfo{leader: v.Leader, members: v.Members, pending: v.Pending}
 	}
-	uid, err := uuid.GenerateUUID()
+	z.nInfo = state.Nodes
+	z.tablets = state.Tablets
+	if z.tablets == nil {
+		z.tablets = make(map[string]*tablet)
+	}
+	z.predicates = state.Predicates
+	if z.predicates == nil {
+		z.predicates = make(map[string]*predicate)
+	}
+	z.schemaVersion = state.SchemaVersion
+	z.reverseTasks = state.ReverseTasks
+	if z.reverseTasks == nil {
+		z.reverseTasks = make(map[string]*reverseTask)
+	}
+}
+
+// loadState recovers the ring and the tables persisted in bolt
+func (z *ZeroServer) loadState() error {
+	state, err := z.c.load()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	z.setState(state)
+	z.logger.Info("Recovered cluster state", zap.Int("groups", len(state.Groups)), zap.Int("nodes", len(state.Nodes)))
+	return nil
+}
+
+func (z *ZeroServer) isLeader() bool {
+	return z.raft.State() == raft.Leader
+}
 
+// leaderPeer returns the zero that is currently the raft leader
+func (z *ZeroServer) leaderPeer() (*zeroPeer, error) {
+	addr := string(z.raft.Leader())
+	if addr == "" {
+		return nil, errNoLeader
+	}
 	z.mut.Lock()
 	defer z.mut.Unlock()
-	err = z.c.addGroup(uid)
+	peer, ok := z.peers[addr]
+	if !ok {
+		return nil, errNoLeader
+	}
+	return peer, nil
+}
+
+// leaderClient is used by followers to forward the rpc to the leader
+func (z *ZeroServer) leaderClient() (pb.ZeroClient, error) {
+	peer, err := z.leaderPeer()
 	if err != nil {
 		return nil, err
 	}
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	con, ok := z.conns[peer.GrpcAddress]
+	if !ok {
+		con, err = grpc.Dial(peer.GrpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, err
+		}
+		z.conns[peer.GrpcAddress] = con
+	}
+	return pb.NewZeroClient(con), nil
+}
 
-	node.GroupId = uid
-	z.nInfo[node.GetId()] = node
-	z.gInfo[uid] = &group
+// propose replicates the command through raft and waits for it to be applied
+func (z *ZeroServer) propose(c *command) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f := z.raft.Apply(b, raftTimeout)
+	if err := f.Error(); err != nil {
+		return err
+	}
+	if err, ok := f.Response().(error); ok {
+		return err
+	}
+	return nil
+}
 
-	return &pb.Group{
-		Id:                uid,
-		LeaderRaftAddress: node.GetRaftAddress(),
-		LeaderHttpAddress: node.GetHttpAddress(),
-		Members:           1,
-	}, nil
+// monitorLeadership registers this zero as a peer every time it becomes the
+// leader, so that followers know where to forward requests, and resumes the
+// rebalancing of groups that are still pending
+func (z *ZeroServer) monitorLeadership() {
+	for leader := range z.raft.LeaderCh() {
+		if !leader {
+			continue
+		}
+		z.logger.Info("became the zero leader")
+		z.mut.Lock()
+		z.resetHealth()
+		var pending []string
+		for k, v := range z.gInfo {
+			if v.pending {
+				pending = append(pending, k)
+			}
+		}
+		z.mut.Unlock()
+		// finish the moves a previous leader did not get to
+		for _, grp := range pending {
+			z.scheduleRebalance(grp)
+		}
+		if err := z.propose(&command{OpType: addPeer, Peer: z.self}); err != nil {
+			z.logger.Error("Could not register as a zero peer", zap.Error(err))
+		}
+	}
+}
+
+// joinPeer adds a new zero to the raft group, only the leader can do this
+func (z *ZeroServer) joinPeer(peer *zeroPeer) error {
+	cfgFuture := z.raft.GetConfiguration()
+	if err := cfgFuture.Error(); err != nil {
+		return err
+	}
+	for _, srv := range cfgFuture.Configuration().Servers {
+		if srv.ID == raft.ServerID(peer.Id) || srv.Address == raft.ServerAddress(peer.RaftAddress) {
+			if srv.ID == raft.ServerID(peer.Id) && srv.Address == raft.ServerAddress(peer.RaftAddress) {
+				return z.propose(&command{OpType: addPeer, Peer: peer})
+			}
+			future := z.raft.RemoveServer(srv.ID, 0, 0)
+			if err := future.Error(); err != nil {
+				return err
+			}
+		}
+	}
+	f := z.raft.AddVoter(raft.ServerID(peer.Id), raft.ServerAddress(peer.RaftAddress), 0, 0)
+	if err := f.Error(); err != nil {
+		return err
+	}
+	return z.propose(&command{OpType: addPeer, Peer: peer})
+}
+
+func (z *ZeroServer) CreateAGroup(ctx context.Context, node *pb.Node) (*pb.Group, error) {
+	if !z.isLeader() {
+		cl, err := z.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return cl.CreateAGroup(ctx, node)
+	}
+	z.logger.Info("node asking to create a group")
+	z.leaderMut.Lock()
+	defer z.leaderMut.Unlock()
+	return z.newGroup(node)
+}
+
+// newGroup starts a group led by the node, the caller holds z.leaderMut
+func (z *ZeroServer) newGroup(node *pb.Node) (*pb.Group, error) {
+	uid, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	err = z.propose(&command{OpType: createGroup, GroupId: uid, Node: node})
+	if err != nil {
+		return nil, err
+	}
+	grp, err := z.GetGroupInfo(uid)
+	if err != nil {
+		return nil, err
+	}
+	if grp.GetPending() {
+		z.scheduleRebalance(uid)
+	}
+	return grp, nil
 }
 
 func (z *ZeroServer) JoinAGroup(ctx context.Context, node *pb.Node) (*pb.Group, error) {
+	if !z.isLeader() {
+		cl, err := z.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return cl.JoinAGroup(ctx, node)
+	}
 	z.logger.Info("node asking to join a group")
+	z.leaderMut.Lock()
+	defer z.leaderMut.Unlock()
 	// if we already know about this group then
 	z.mut.Lock()
-	defer z.mut.Unlock()
 	if memNode, ok := z.nInfo[node.GetId()]; ok {
-		ginfo := z.gInfo[memNode.GetGroupId()]
-		leader := ginfo.leader
-		return &pb.Group{
-			Id:                memNode.GetGroupId(),
-			LeaderRaftAddress: leader.GetRaftAddress(),
-			LeaderHttpAddress: leader.GetHttpAddress(),
-			Members:           int32(ginfo.members), // this would not change
-			// else we do not know about this guy
-		}, nil
-	}
-	minMemberGroup := ""
-	minMembers := math.MaxUint32
-	for k, v := range z.gInfo {
-		if int(v.members) < minMembers {
-			minMemberGroup = k
-			minMembers = int(v.members)
-		}
+		z.mut.Unlock()
+		// this would not change
+		return z.GetGroupInfo(memNode.GetGroupId())
 	}
-	z.logger.Info("Group selected finally", zap.String("name", minMemberGroup))
-	if minMemberGroup == "" {
-		z.logger.Error("Could not find minimum member group")
-		return nil, nil
+	// else we do not know about this guy
+	grp, conflict := z.pickGroup(node)
+	z.mut.Unlock()
+	if grp == "" {
+		z.logger.Info("Every group is full, starting a new one", zap.String("node", node.GetId()))
+		return z.newGroup(node)
 	}
-	if entry, ok := z.gInfo[minMemberGroup]; ok {
-		entry.members += 1
-		node.GroupId = minMemberGroup
-		z.nInfo[node.GetId()] = node
+	if conflict {
+		if z.placement == placementStrict {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"every group with room already has a replica in %s", failureDomain(node))
+		}
+		z.logger.Warn("Two replicas of the group share a failure domain", zap.String("group", grp),
+			zap.String("node", node.GetId()), zap.String("domain", failureDomain(node)))
 	}
-
-	return &pb.Group{
-		Id:                minMemberGroup,
-		LeaderRaftAddress: z.gInfo[minMemberGroup].leader.GetRaftAddress(),
-		LeaderHttpAddress: z.gInfo[minMemberGroup].leader.GetHttpAddress(),
-		Members:           int32(z.gInfo[minMemberGroup].members),
-	}, nil
+	z.logger.Info("Group selected finally", zap.String("name", grp))
+	err := z.propose(&command{OpType: joinGroup, GroupId: grp, Node: node})
+	if err != nil {
+		return nil, err
+	}
+	return z.GetGroupInfo(grp)
 }
 
 func (z *ZeroServer) UpdateLeader(ctx context.Context, node *pb.Node) (*pb.Group, error) {
+	if !z.isLeader() {
+		cl, err := z.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return cl.UpdateLeader(ctx, node)
+	}
 	z.logger.Info("node asking to update leader of group")
 	// update leader
+	err := z.propose(&command{OpType: updateLeader, Node: node})
+	if err != nil {
+		return nil, err
+	}
+	return z.GetGroupInfo(node.GetGroupId())
+}
+
+// RemoveNode takes the node out of the raft configuration of its group
+// through the group leader and then forgets about it
+func (z *ZeroServer) RemoveNode(ctx context.Context, node *pb.Node) (*pb.Group, error) {
+	if !z.isLeader() {
+		cl, err := z.leaderClient()
+		if err != nil {
+			return nil, err
+		}
+		return cl.RemoveNode(ctx, node)
+	}
+	z.logger.Info("node asking to be removed", zap.String("node", node.GetId()))
+	z.leaderMut.Lock()
+	defer z.leaderMut.Unlock()
 	z.mut.Lock()
-	defer z.mut.Unlock()
-	var memN int
-	if entry, ok := z.gInfo[node.GetGroupId()]; ok {
-		z.nInfo[node.GetId()] = node
-		entry.leader = node
-		memN = entry.members
+	memNode, ok := z.nInfo[node.GetId()]
+	if !ok {
+		z.mut.Unlock()
+		return nil, status.Errorf(codes.NotFound, "node %s is not part of any group", node.GetId())
 	}
-	return &pb.Group{
-		Id:                node.GetGroupId(),
-		LeaderRaftAddress: node.GetRaftAddress(),
-		LeaderHttpAddress: node.GetHttpAddress(),
-		Members:           int32(memN),
-	}, nil
+	grp := memNode.GetGroupId()
+	entry := z.gInfo[grp]
+	members, leader := entry.members, entry.leader
+	z.mut.Unlock()
+	if members <= 1 {
+		return nil, status.Errorf(codes.FailedPrecondition, "node %s is the last member of group %s", node.GetId(), grp)
+	}
+	if leader == nil {
+		return nil, status.Errorf(codes.Unavailable, "group %s has no leader", grp)
+	}
+	if err := z.removeFromGroup(ctx, leader.GetHttpAddress(), memNode.GetId()); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "could not remove the node from the group: %v", err)
+	}
+	if err := z.propose(&command{OpType: removeNode, Node: memNode}); err != nil {
+		return nil, err
+	}
+	return z.GetGroupInfo(grp)
 }
 
-func (z *ZeroServer) GetGroupInfo(id string) (*pb.Group, error) {
+// removeFromGroup asks the leader of the alpha group to drop the node from raft
+func (z *ZeroServer) removeFromGroup(ctx context.Context, leaderAddr, id string) error {
+	b, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/remove", leaderAddr), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := z.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("group leader answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
 
+func (z *ZeroServer) GetGroupInfo(id string) (*pb.Group, error) {
 	z.mut.Lock()
 	defer z.mut.Unlock()
+	return z.group(id), nil
+}
+
+// group describes a group with its members, the caller holds z.mut
+func (z *ZeroServer) group(id string) *pb.Group {
 	var memN int
 	var leaderHTTP, leaderRaft string
+	var pending bool
 	if entry, ok := z.gInfo[id]; ok {
 		leaderHTTP = entry.leader.GetHttpAddress()
 		leaderRaft = entry.leader.GetRaftAddress()
 		memN = entry.members
+		pending = entry.pending
 	}
+	var nodes []*pb.Node
+	for _, n := range z.nInfo {
+		if n.GetGroupId() == id {
+			nodes = append(nodes, z.withHealth(n))
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].GetId() < nodes[j].GetId() })
 	return &pb.Group{
 		Id:                id,
 		LeaderRaftAddress: leaderRaft,
 		LeaderHttpAddress: leaderHTTP,
 		Members:           int32(memN),
-	}, nil
+		Nodes:             nodes,
+		Health:            groupHealth(nodes),
+		Pending:           pending,
+	}
 }
 
-func (z *ZeroServer) GetLeader(context.Context, *pb.Group) (*pb.Node, error) {
+func (z *ZeroServer) GetLeader(ctx context.Context, grp *pb.Group) (*pb.Node, error) {
 	z.logger.Info("node asking to fetch the leader of a group")
-	return nil, nil
+	return z.leaderOf(grp.GetId())
+}
+
+// leaderOf returns the leader of the group unless it is dead
+func (z *ZeroServer) leaderOf(id string) (*pb.Node, error) {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	entry, ok := z.gInfo[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "group %s does not exist", id)
+	}
+	if entry.leader == nil {
+		return nil, status.Errorf(codes.Unavailable, "group %s has no leader", id)
+	}
+	leader := z.withHealth(entry.leader)
+	if leader.GetHealth() == pb.Health_DEAD {
+		return nil, status.Errorf(codes.Unavailable, "the leader of group %s is dead", id)
+	}
+	return leader, nil
 }
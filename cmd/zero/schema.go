@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	pb "example.com/graphd/cmd/zero/grpc"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// The schema tells for each relation the type of its values, whether it holds
+// one value or many and whether its reverse edges are maintained. It lives in
+// the zero raft group, PUT /schema/<relation> changes it. The alphas check the
+// writes against it, they keep a copy and fetch it again with GetSchema when
+// the version their heartbeats return changes. A relation without a schema is
+// untyped, many valued, not reversed and not indexed.
+
+const (
+	// any value, the relations written before they had a schema
+	defaultType = "default"
+	// the values are node ids, the relation is an edge between nodes
+	uidType = "uid"
+
+	cardinalityOne  = "one"
+	cardinalityMany = "many"
+)
+
+// the tokenizers of the indexes, see search.go
+var tokenizers = map[string]bool{
+	"exact":    true,
+	"term":     true,
+	"fulltext": true,
+}
+
+var valueTypes = map[string]bool{
+	defaultType: true,
+	uidType:     true,
+	"string":    true,
+	"int":       true,
+	"float":     true,
+	"bool":      true,
+	"datetime":  true,
+	"geo":       true,
+}
+
+// predicate is the schema of a relation
+type predicate struct {
+	Relation    string `json:"relation"`
+	Type        string `json:"type"`
+	Cardinality string `json:"cardinality"`
+	Reverse     bool   `json:"reverse"`
+	// the tokenizers the alphas index the values with
+	Index []string `json:"index,omitempty"`
+}
+
+// fill sets the fields left empty to their default, the predicates stored
+// before the schema had types only have reverse set
+func (p *predicate) fill() *predicate {
+	if p.Type == "" {
+		p.Type = defaultType
+	}
+	if p.Cardinality == "" {
+		p.Cardinality = cardinalityMany
+	}
+	sort.Strings(p.Index)
+	return p
+}
+
+// isDefault tells if the relation has the default schema, such predicates
+// are not stored
+func (p *predicate) isDefault() bool {
+	return (p.Type == "" || p.Type == defaultType) &&
+		(p.Cardinality == "" || p.Cardinality == cardinalityMany) && !p.Reverse && len(p.Index) == 0
+}
+
+// hasIndex tells if the values are indexed by the tokenizer
+func (p *predicate) hasIndex(tokenizer string) bool {
+	for _, t := range p.Index {
+		if t == tokenizer {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *predicate) validate() error {
+	switch {
+	case strings.HasPrefix(p.Relation, reversePrefix):
+		return fmt.Errorf("the reverse relations have no schema of their own")
+	case !valueTypes[p.Type]:
+		return fmt.Errorf("unknown type %q", p.Type)
+	case p.Cardinality != cardinalityOne && p.Cardinality != cardinalityMany:
+		return fmt.Errorf("the cardinality should be one or many")
+	case p.Reverse && p.Type != defaultType && p.Type != uidType:
+		return fmt.Errorf("only the relations between nodes, of type uid, can be reversed")
+	case len(p.Index) > 0 && p.Type != defaultType && p.Type != "string":
+		return fmt.Errorf("only the string values can be indexed")
+	}
+	for i, t := range p.Index {
+		if !tokenizers[t] {
+			return fmt.Errorf("unknown index %q, expected exact, term or fulltext", t)
+		}
+		if i > 0 && p.Index[i-1] == t {
+			return fmt.Errorf("the index %q appears twice", t)
+		}
+	}
+	return nil
+}
+
+func (p *predicate) toProto() *pb.Predicate {
+	return &pb.Predicate{
+		Relation:    p.Relation,
+		Type:        p.Type,
+		Cardinality: p.Cardinality,
+		Reverse:     p.Reverse,
+		Index:       p.Index,
+	}
+}
+
+// getPredicate the caller holds z.mut
+func (z *ZeroServer) getPredicate(relation string) *predicate {
+	if p, ok := z.predicates[relation]; ok {
+		cp := *p
+		return cp.fill()
+	}
+	return (&predicate{Relation: relation}).fill()
+}
+
+// schema returns every relation with a schema, the caller holds z.mut
+func (z *ZeroServer) schema() []*predicate {
+	out := make([]*predicate, 0, len(z.predicates))
+	for relation := range z.predicates {
+		out = append(out, z.getPredicate(relation))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Relation < out[j].Relation })
+	return out
+}
+
+// GetSchema is called by the alphas when the version of the schema changed
+func (z *ZeroServer) GetSchema(ctx context.Context, req *pb.SchemaRequest) (*pb.Schema, error) {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	res := &pb.Schema{Version: z.schemaVersion}
+	for _, p := range z.schema() {
+		res.Predicates = append(res.Predicates, p.toProto())
+	}
+	return res, nil
+}
+
+func (s *httpService) handleSchemaGet(w http.ResponseWriter, r *http.Request) {
+	z := s.server
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	if relation, ok := mux.Vars(r)["relation"]; ok {
+		s.writeJSON(w, z.getPredicate(relation))
+		return
+	}
+	s.writeJSON(w, map[string]interface{}{"version": z.schemaVersion, "predicates": z.schema()})
+}
+
+// handleSchemaPut sets the schema of a relation, the fields left out take
+// their default, {"type": "string", "cardinality": "many", "index": ["term"]}
+func (s *httpService) handleSchemaPut(w http.ResponseWriter, r *http.Request) {
+	relation := mux.Vars(r)["relation"]
+	b, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		s.writeError(w, 400, "Could not open request body")
+		return
+	}
+	if s.forwardToLeader(w, r, b) {
+		return
+	}
+	var next predicate
+	if err := json.Unmarshal(b, &next); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	next.Relation = relation
+	if err := next.fill().validate(); err != nil {
+		s.writeError(w, 400, "Invalid schema: "+err.Error())
+		return
+	}
+	if err := s.server.propose(&command{OpType: setPredicate, Predicate: &next}); err != nil {
+		s.logger.Error("Could not set the schema", zap.Error(err))
+		s.writeError(w, 500, "Could not set the schema: "+err.Error())
+		return
+	}
+	s.writeJSON(w, &next)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"go.uber.org/zap"
+)
+
+// The alphas index the values of the relations whose schema names
+// tokenizers, each group for the keys it holds, so a search asks every group
+// holding keys of the relation and joins the nodes they found. A tablet is
+// asked of its group alone.
+//
+//	eq(name, "Alice Smith")        the whole value, with an exact index
+//	anyofterms(name, "alice bob")  any of the words, with a term index
+//	allofterms(name, "alice bob")  all the words
+//	anyoftext(bio, "running dogs") any of the words once stemmed and without
+//	alloftext(bio, "running dogs") the stop words, or all of them, with a
+//	                               fulltext index
+//
+// The words are compared in lower case.
+
+type searchRequest struct {
+	Relation    string `json:"relation"`
+	Func        string `json:"func"`
+	Text        string `json:"text"`
+	Consistency string `json:"consistency,omitempty"`
+}
+
+// errNotIndexed is answered 400, the schema lacks the index
+type errNotIndexed struct {
+	relation, tokenizer string
+}
+
+func (e *errNotIndexed) Error() string {
+	return fmt.Sprintf("%s has no %s index", e.relation, e.tokenizer)
+}
+
+// searchGroup runs the search on one group
+func (s *httpService) searchGroup(ctx context.Context, grp string, req *searchRequest) ([]string, error) {
+	b, err := json.Marshal(&searchRequest{Relation: req.Relation, Func: req.Func, Text: req.Text})
+	if err != nil {
+		return nil, err
+	}
+	uri := searchPath
+	if req.Consistency != "" {
+		uri += "?" + url.Values{"consistency": {req.Consistency}}.Encode()
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	resp := s.send(r, b, grp)
+	if resp == nil {
+		return nil, fmt.Errorf("could not reach group %s", grp)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("group %s answered %d to a search", grp, resp.StatusCode)
+	}
+	var res struct {
+		Ids []string `json:"ids"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res.Ids, nil
+}
+
+// search returns the nodes the search function finds, sorted. The groups
+// are asked in parallel.
+func (s *httpService) search(ctx context.Context, req *searchRequest) ([]string, error) {
+	sf, ok := pb.SearchFuncs[req.Func]
+	if !ok {
+		return nil, fmt.Errorf("unknown search function %q", req.Func)
+	}
+	s.server.mut.Lock()
+	p := s.server.getPredicate(req.Relation)
+	s.server.mut.Unlock()
+	if !p.hasIndex(sf.Tokenizer) {
+		return nil, &errNotIndexed{req.Relation, sf.Tokenizer}
+	}
+	grps := s.server.relationGroups(req.Relation)
+	found := make(map[string]bool)
+	var mut sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for _, grp := range grps {
+		wg.Add(1)
+		go func(grp string) {
+			defer wg.Done()
+			ids, err := s.searchGroup(ctx, grp, req)
+			mut.Lock()
+			defer mut.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for _, id := range ids {
+				found[id] = true
+			}
+		}(grp)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	ids := make([]string, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// handleSearch serves POST /search and answers the nodes found, sorted
+//
+//	{"relation": "name", "func": "anyofterms", "text": "alice bob", "consistency": "linearizable"}
+func (s *httpService) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req searchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if !consistencies[req.Consistency] {
+		s.writeError(w, 400, "The consistency should be linearizable, leader or stale")
+		return
+	}
+	if _, ok := pb.SearchFuncs[req.Func]; !ok {
+		s.writeError(w, 400, "The function should be eq, anyofterms, allofterms, anyoftext or alloftext")
+		return
+	}
+	ids, err := s.search(r.Context(), &req)
+	if e, ok := err.(*errNotIndexed); ok {
+		s.writeError(w, 400, "Could not search: "+e.Error())
+		return
+	}
+	if err != nil {
+		s.logger.Info("Could not search", zap.Error(err))
+		s.writeError(w, 502, "Could not search the groups: "+err.Error())
+		return
+	}
+	s.writeJSON(w, map[string][]string{"ids": ids})
+}
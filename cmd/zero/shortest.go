@@ -0,0 +1,353 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// POST /shortest finds a shortest path between two nodes over some relations
+//
+//	{"from": "alice", "to": "erin", "relations": ["friend"], "depth": 6, "timeout": "5s"}
+//
+// The search goes breadth first a hop at a time, every hop reading the
+// relations of the whole frontier from the groups owning the keys. When all
+// the relations are marked @reverse the search also goes back from the
+// target over the ~relations, expanding the smaller frontier each time, so
+// it meets in the middle after far fewer reads. Otherwise it only goes forward.
+//
+// With "weight": "<facet>" the edges weigh the value of that facet and the
+// search is Dijkstra's, forward only and still bounded by the depth. An edge
+// without the facet weighs 1, one whose facet is not a number at least 0 is
+// not followed.
+
+const (
+	defaultShortestDepth   = 6
+	maxShortestDepth       = 12
+	defaultShortestTimeout = 5 * time.Second
+	maxShortestTimeout     = 30 * time.Second
+	// the search gives up past this many nodes reached
+	maxShortestNodes = 100000
+)
+
+type shortestRequest struct {
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Relations   []string `json:"relations"`
+	Depth       int      `json:"depth"`
+	Timeout     string   `json:"timeout"`
+	Consistency string   `json:"consistency"`
+	// the facet the edges weigh, every edge weighs 1 when empty
+	Weight string `json:"weight"`
+}
+
+type shortestPath struct {
+	Path          []string        `json:"path"`
+	Edges         []*traverseEdge `json:"edges"`
+	Length        int             `json:"length"`
+	Bidirectional bool            `json:"bidirectional"`
+	// the sum of the weights of the edges, for a weighted search
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// reach tells how the search got to a node, via is the node it was read
+// from, empty for the node the search started at
+type reach struct {
+	via, relation string
+	depth         int
+}
+
+// searchSide is one direction of the search, the backward side reads the
+// ~relations so via is the next node on the path rather than the previous
+type searchSide struct {
+	reached  map[string]reach
+	frontier []string
+	depth    int
+	backward bool
+}
+
+func newSearchSide(root string, backward bool) *searchSide {
+	return &searchSide{
+		reached:  map[string]reach{root: {}},
+		frontier: []string{root},
+		backward: backward,
+	}
+}
+
+// expand reads the relations of the frontier and returns the nodes reached
+// for the first time, they form the next frontier
+func (s *httpService) expand(ctx context.Context, sd *searchSide, relations []string, consistency string) ([]string, error) {
+	var next []string
+	for _, relation := range relations {
+		read := relation
+		if sd.backward {
+			read = reversePrefix + relation
+		}
+		adj, err := s.readAll(ctx, sd.frontier, read, consistency)
+		if err != nil {
+			return nil, err
+		}
+		for i, n := range sd.frontier {
+			for _, v := range valueStrings(adj[i]) {
+				if _, ok := sd.reached[v]; !ok {
+					sd.reached[v] = reach{via: n, relation: relation, depth: sd.depth + 1}
+					next = append(next, v)
+				}
+			}
+		}
+	}
+	sd.frontier = next
+	sd.depth++
+	return next, nil
+}
+
+var (
+	errNoPath   = errors.New("no path between the nodes within the depth")
+	errTooLarge = fmt.Errorf("the search reached more than %d nodes", maxShortestNodes)
+)
+
+func (s *httpService) shortest(ctx context.Context, req *shortestRequest) (*shortestPath, error) {
+	if req.Weight != "" {
+		return s.weightedShortest(ctx, req)
+	}
+	bidirectional := true
+	for _, relation := range req.Relations {
+		bidirectional = bidirectional && s.server.isReverse(relation)
+	}
+	p := &shortestPath{Path: []string{req.From}, Edges: []*traverseEdge{}, Bidirectional: bidirectional}
+	if req.From == req.To {
+		return p, nil
+	}
+	fwd, bwd := newSearchSide(req.From, false), newSearchSide(req.To, true)
+	for fwd.depth+bwd.depth < req.Depth {
+		sd, other := fwd, bwd
+		if bidirectional && len(bwd.frontier) < len(fwd.frontier) {
+			sd, other = bwd, fwd
+		}
+		if len(sd.frontier) == 0 {
+			break
+		}
+		next, err := s.expand(ctx, sd, req.Relations, req.Consistency)
+		if err != nil {
+			return nil, err
+		}
+		// the whole hop is read so the shortest of the paths meeting in it is kept
+		meet, best := "", 0
+		for _, n := range next {
+			if r, ok := other.reached[n]; ok && (meet == "" || sd.depth+r.depth < best) {
+				meet, best = n, sd.depth+r.depth
+			}
+		}
+		if meet != "" {
+			return joinPath(p, fwd, bwd, meet), nil
+		}
+		if len(fwd.reached)+len(bwd.reached) > maxShortestNodes {
+			return nil, errTooLarge
+		}
+	}
+	return nil, errNoPath
+}
+
+// joinPath walks from the meeting node back to each end
+func joinPath(p *shortestPath, fwd, bwd *searchSide, meet string) *shortestPath {
+	var path []string
+	var edges []*traverseEdge
+	for n := meet; n != ""; n = fwd.reached[n].via {
+		path = append([]string{n}, path...)
+		if r := fwd.reached[n]; r.via != "" {
+			edges = append([]*traverseEdge{{From: r.via, Relation: r.relation, To: n}}, edges...)
+		}
+	}
+	for n := bwd.reached[meet]; n.via != ""; {
+		edges = append(edges, &traverseEdge{From: path[len(path)-1], Relation: n.relation, To: n.via})
+		path = append(path, n.via)
+		n = bwd.reached[n.via]
+	}
+	p.Path, p.Edges, p.Length = path, edges, len(edges)
+	return p
+}
+
+// label is a way to reach a node in a weighted search. A node is settled by
+// its lightest path first, it is only reached again by paths with fewer
+// hops since a path cut short by the depth may need them.
+type label struct {
+	node     string
+	weight   float64
+	hops     int
+	prev     *label
+	relation string
+	facets   map[string]interface{}
+}
+
+// labelHeap orders the labels by weight and then by hops
+type labelHeap []*label
+
+func (h labelHeap) Len() int { return len(h) }
+func (h labelHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].hops < h[j].hops
+}
+func (h labelHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *labelHeap) Push(x interface{}) { *h = append(*h, x.(*label)) }
+func (h *labelHeap) Pop() interface{} {
+	old := *h
+	l := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return l
+}
+
+// edgeWeight returns what the edge weighs, ok is false when the facet is not
+// a number at least 0
+func edgeWeight(v edgeValue, facet string) (float64, bool) {
+	f, ok := v.Facets[facet]
+	if !ok {
+		return 1, true
+	}
+	w, ok := f.(float64)
+	return w, ok && w >= 0
+}
+
+// weightedShortest is Dijkstra's over the labels. The labels of the same
+// weight are expanded together so their relations are read at once.
+func (s *httpService) weightedShortest(ctx context.Context, req *shortestRequest) (*shortestPath, error) {
+	// the fewest hops a node was settled with
+	settled := make(map[string]int)
+	adj := make(map[string][][]edgeValue)
+	h := &labelHeap{{node: req.From}}
+	for h.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var batch []*label
+		for weight := (*h)[0].weight; h.Len() > 0 && (*h)[0].weight == weight; {
+			l := heap.Pop(h).(*label)
+			if hops, ok := settled[l.node]; ok && hops <= l.hops {
+				continue
+			}
+			if l.node == req.To {
+				return weightedPath(l), nil
+			}
+			settled[l.node] = l.hops
+			if l.hops < req.Depth {
+				batch = append(batch, l)
+			}
+		}
+		if len(settled) > maxShortestNodes {
+			return nil, errTooLarge
+		}
+		var read []string
+		for _, l := range batch {
+			if _, ok := adj[l.node]; !ok {
+				adj[l.node] = make([][]edgeValue, len(req.Relations))
+				read = append(read, l.node)
+			}
+		}
+		for i, relation := range req.Relations {
+			vals, err := s.readAll(ctx, read, relation, req.Consistency)
+			if err != nil {
+				return nil, err
+			}
+			for j, n := range read {
+				adj[n][i] = vals[j]
+			}
+		}
+		for _, l := range batch {
+			for i, relation := range req.Relations {
+				for _, v := range adj[l.node][i] {
+					w, ok := edgeWeight(v, req.Weight)
+					if !ok {
+						continue
+					}
+					if hops, ok := settled[v.Value]; ok && hops <= l.hops+1 {
+						continue
+					}
+					heap.Push(h, &label{
+						node:     v.Value,
+						weight:   l.weight + w,
+						hops:     l.hops + 1,
+						prev:     l,
+						relation: relation,
+						facets:   v.Facets,
+					})
+				}
+			}
+		}
+	}
+	return nil, errNoPath
+}
+
+// weightedPath walks from the label back to the start
+func weightedPath(l *label) *shortestPath {
+	weight := l.weight
+	p := &shortestPath{Length: l.hops, Weight: &weight}
+	p.Path = make([]string, l.hops+1)
+	p.Edges = make([]*traverseEdge, l.hops)
+	for ; l != nil; l = l.prev {
+		p.Path[l.hops] = l.node
+		if l.prev != nil {
+			p.Edges[l.hops-1] = &traverseEdge{From: l.prev.node, Relation: l.relation, To: l.node, Facets: l.facets}
+		}
+	}
+	return p
+}
+
+func (s *httpService) handleShortest(w http.ResponseWriter, r *http.Request) {
+	var req shortestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if req.From == "" || req.To == "" || len(req.Relations) == 0 {
+		s.writeError(w, 400, "The two nodes and the relations to follow are required")
+		return
+	}
+	for _, relation := range req.Relations {
+		if relation == "" {
+			s.writeError(w, 400, "The relations can not be empty")
+			return
+		}
+	}
+	if req.Depth == 0 {
+		req.Depth = defaultShortestDepth
+	}
+	if req.Depth < 0 || req.Depth > maxShortestDepth {
+		s.writeError(w, 400, fmt.Sprintf("The depth should be between 1 and %d", maxShortestDepth))
+		return
+	}
+	timeout := defaultShortestTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 || d > maxShortestTimeout {
+			s.writeError(w, 400, fmt.Sprintf("The timeout should be a duration up to %s", maxShortestTimeout))
+			return
+		}
+		timeout = d
+	}
+	if !consistencies[req.Consistency] {
+		s.writeError(w, 400, "The consistency should be linearizable, leader or stale")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	p, err := s.shortest(ctx, &req)
+	switch {
+	case err == errNoPath:
+		s.writeError(w, 404, "There is no path between the nodes within the depth")
+	case err == errTooLarge:
+		s.writeError(w, 404, "No path found before the search reached its node limit")
+	case ctx.Err() == context.DeadlineExceeded:
+		s.writeError(w, 504, "No path found before the timeout")
+	case err != nil:
+		s.logger.Info("Could not search the graph", zap.Error(err))
+		s.writeError(w, 502, "Could not read a relation: "+err.Error())
+	default:
+		s.writeJSON(w, p)
+	}
+}
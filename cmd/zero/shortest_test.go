@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "example.com/graphd/cmd/zero/grpc"
+	"github.com/buraksezer/consistent"
+	"go.uber.org/zap"
+)
+
+// newTestService returns a zero with a single group whose leader is a fake
+// alpha answering the reads from data, id%relation -> values
+func newTestService(t *testing.T, data map[string][]edgeValue) *httpService {
+	t.Helper()
+	alpha := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+			vals, ok := data[strings.Join(parts, SEPARATOR)]
+			if len(parts) != 2 || !ok {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(vals)
+			return
+		}
+		if r.URL.Path != batchPath {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Keys []queryKey `json:"keys"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		values := make([][]edgeValue, len(req.Keys))
+		for i, k := range req.Keys {
+			values[i] = data[k.Id+SEPARATOR+k.Relation]
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"values": values})
+	}))
+	t.Cleanup(alpha.Close)
+	ch := &consistentHashHandler{c: consistent.New(nil, consistent.Config{
+		PartitionCount:    7,
+		ReplicationFactor: 20,
+		Load:              1.25,
+		Hasher:            hasher{},
+	})}
+	ch.c.Add(group("g1"))
+	logger := zap.NewNop()
+	z, err := newZeroServer(logger, ch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leader := &pb.Node{Id: "a1", GroupId: "g1", HttpAddress: strings.TrimPrefix(alpha.URL, "http://")}
+	z.gInfo["g1"] = &groupInfo{leader: leader, members: 1}
+	z.nInfo["a1"] = leader
+	return &httpService{logger: logger, server: z, c: ch, client: alpha.Client()}
+}
+
+// showPath writes the path as a-friend->b
+func showPath(p *shortestPath) string {
+	var sb strings.Builder
+	sb.WriteString(p.Path[0])
+	for _, e := range p.Edges {
+		fmt.Fprintf(&sb, "-%s->%s", e.Relation, e.To)
+	}
+	return sb.String()
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		fwd, bwd map[string]reach
+		meet     string
+		want     string
+	}{
+		{
+			"middle",
+			map[string]reach{"a": {}, "b": {"a", "friend", 1}, "c": {"b", "knows", 2}},
+			map[string]reach{"e": {}, "d": {"e", "friend", 1}, "c": {"d", "friend", 2}},
+			"c",
+			"a-friend->b-knows->c-friend->d-friend->e",
+		},
+		{
+			"at the start",
+			map[string]reach{"a": {}},
+			map[string]reach{"c": {}, "b": {"c", "friend", 1}, "a": {"b", "knows", 2}},
+			"a",
+			"a-knows->b-friend->c",
+		},
+		{
+			"at the end",
+			map[string]reach{"a": {}, "b": {"a", "friend", 1}, "c": {"b", "friend", 2}},
+			map[string]reach{"c": {}},
+			"c",
+			"a-friend->b-friend->c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := joinPath(&shortestPath{}, &searchSide{reached: tt.fwd}, &searchSide{reached: tt.bwd, backward: true}, tt.meet)
+			if got := showPath(p); got != tt.want {
+				t.Errorf("joinPath() = %s, want %s", got, tt.want)
+			}
+			if p.Length != len(p.Edges) || len(p.Path) != len(p.Edges)+1 {
+				t.Errorf("joinPath() has length %d, %d nodes and %d edges", p.Length, len(p.Path), len(p.Edges))
+			}
+			for i, e := range p.Edges {
+				if e.From != p.Path[i] || e.To != p.Path[i+1] {
+					t.Errorf("edge %d goes from %s to %s, the path from %s to %s", i, e.From, e.To, p.Path[i], p.Path[i+1])
+				}
+			}
+		})
+	}
+}
+
+// randomGraph returns the friend relation and its reverse between n nodes
+func randomGraph(r *rand.Rand, n, edges int) (map[string][]edgeValue, map[string][]string) {
+	data := make(map[string][]edgeValue)
+	adj := make(map[string][]string)
+	seen := make(map[[2]int]bool)
+	for i := 0; i < edges; i++ {
+		a, b := r.Intn(n), r.Intn(n)
+		if a == b || seen[[2]int{a, b}] {
+			continue
+		}
+		seen[[2]int{a, b}] = true
+		from, to := fmt.Sprint("n", a), fmt.Sprint("n", b)
+		data[from+SEPARATOR+"friend"] = append(data[from+SEPARATOR+"friend"], edgeValue{Value: to})
+		data[to+SEPARATOR+"~friend"] = append(data[to+SEPARATOR+"~friend"], edgeValue{Value: from})
+		adj[from] = append(adj[from], to)
+	}
+	return data, adj
+}
+
+// bfsLength is the length of a shortest path, -1 when there is none
+func bfsLength(adj map[string][]string, from, to string) int {
+	dist := map[string]int{from: 0}
+	queue := []string{from}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if n == to {
+			return dist[n]
+		}
+		for _, m := range adj[n] {
+			if _, ok := dist[m]; !ok {
+				dist[m] = dist[n] + 1
+				queue = append(queue, m)
+			}
+		}
+	}
+	return -1
+}
+
+func TestShortestMeetsInTheMiddle(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 20; round++ {
+		data, adj := randomGraph(r, 40, 70)
+		s := newTestService(t, data)
+		s.server.predicates["friend"] = &predicate{Relation: "friend", Reverse: true}
+		for pair := 0; pair < 10; pair++ {
+			from, to := fmt.Sprint("n", r.Intn(40)), fmt.Sprint("n", r.Intn(40))
+			want := bfsLength(adj, from, to)
+			for _, reversed := range []bool{true, false} {
+				s.server.predicates["friend"].Reverse = reversed
+				req := &shortestRequest{From: from, To: to, Relations: []string{"friend"}, Depth: maxShortestDepth}
+				p, err := s.shortest(context.Background(), req)
+				if want < 0 || want > maxShortestDepth {
+					if err != errNoPath {
+						t.Fatalf("%s to %s: got %v, want no path", from, to, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%s to %s: %v", from, to, err)
+				}
+				if p.Length != want || p.Bidirectional != reversed {
+					t.Errorf("%s to %s: got %s bidirectional %v, want length %d", from, to, showPath(p), p.Bidirectional, want)
+				}
+				if p.Path[0] != from || p.Path[len(p.Path)-1] != to {
+					t.Errorf("%s to %s: got %s", from, to, showPath(p))
+				}
+				for _, e := range p.Edges {
+					if !contains(adj[e.From], e.To) {
+						t.Errorf("%s to %s: %s has no edge %s->%s", from, to, showPath(p), e.From, e.To)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestShortestDepth(t *testing.T) {
+	data := map[string][]edgeValue{
+		"a%friend":  {{Value: "b"}},
+		"b%friend":  {{Value: "c"}},
+		"c%friend":  {{Value: "d"}},
+		"b%~friend": {{Value: "a"}},
+		"c%~friend": {{Value: "b"}},
+		"d%~friend": {{Value: "c"}},
+	}
+	s := newTestService(t, data)
+	s.server.predicates["friend"] = &predicate{Relation: "friend", Reverse: true}
+	for depth := 1; depth <= 4; depth++ {
+		p, err := s.shortest(context.Background(), &shortestRequest{From: "a", To: "d", Relations: []string{"friend"}, Depth: depth})
+		if depth < 3 {
+			if err != errNoPath {
+				t.Errorf("depth %d: got %v, want no path", depth, err)
+			}
+			continue
+		}
+		if err != nil || showPath(p) != "a-friend->b-friend->c-friend->d" {
+			t.Errorf("depth %d: got %v, %v", depth, p, err)
+		}
+	}
+}
+
+func TestWeightedShortest(t *testing.T) {
+	km := func(to string, w interface{}) edgeValue {
+		return edgeValue{Value: to, Facets: map[string]interface{}{"km": w}}
+	}
+	tests := []struct {
+		name   string
+		data   map[string][]edgeValue
+		depth  int
+		want   string
+		weight float64
+	}{
+		{
+			"lighter with more hops",
+			map[string][]edgeValue{"a%road": {km("b", 1.0), km("t", 5.0)}, "b%road": {km("t", 1.0)}},
+			6, "a-road->b-road->t", 2,
+		},
+		{
+			"bounded by the depth",
+			map[string][]edgeValue{"a%road": {km("b", 1.0), km("t", 5.0)}, "b%road": {km("t", 1.0)}},
+			1, "a-road->t", 5,
+		},
+		{
+			"reached again with fewer hops",
+			map[string][]edgeValue{
+				"a%road": {km("b", 1.0), km("c", 5.0)},
+				"b%road": {km("c", 1.0)},
+				"c%road": {km("t", 1.0)},
+			},
+			2, "a-road->c-road->t", 6,
+		},
+		{
+			"no facet weighs one",
+			map[string][]edgeValue{"a%road": {{Value: "b"}, km("t", 3.0)}, "b%road": {{Value: "t"}}},
+			6, "a-road->b-road->t", 2,
+		},
+		{
+			"not a number is not followed",
+			map[string][]edgeValue{"a%road": {km("b", 4.0), km("t", "far")}, "b%road": {km("t", 4.0)}},
+			6, "a-road->b-road->t", 8,
+		},
+		{
+			"negative is not followed",
+			map[string][]edgeValue{"a%road": {km("b", 4.0), km("t", -1.0)}, "b%road": {km("t", 4.0)}},
+			6, "a-road->b-road->t", 8,
+		},
+		{
+			"zero weights",
+			map[string][]edgeValue{"a%road": {km("b", 0.0)}, "b%road": {km("c", 0.0)}, "c%road": {km("t", 0.0)}},
+			6, "a-road->b-road->c-road->t", 0,
+		},
+		{
+			"same node",
+			map[string][]edgeValue{},
+			6, "a", 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, tt.data)
+			to := "t"
+			if tt.want == "a" {
+				to = "a"
+			}
+			req := &shortestRequest{From: "a", To: to, Relations: []string{"road"}, Depth: tt.depth, Weight: "km"}
+			p, err := s.shortest(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := showPath(p); got != tt.want || p.Weight == nil || *p.Weight != tt.weight {
+				t.Errorf("got %s weighing %v, want %s weighing %v", got, p.Weight, tt.want, tt.weight)
+			}
+			if p.Length != len(p.Edges) {
+				t.Errorf("length %d for %d edges", p.Length, len(p.Edges))
+			}
+			for _, e := range p.Edges {
+				if _, ok := e.Facets["km"]; !ok && tt.name != "no facet weighs one" {
+					t.Errorf("the edge %s->%s lost its facets", e.From, e.To)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedShortestNoPath(t *testing.T) {
+	s := newTestService(t, map[string][]edgeValue{"a%road": {{Value: "b"}}, "b%road": {{Value: "c"}}})
+	for _, depth := range []int{1, 6} {
+		_, err := s.shortest(context.Background(), &shortestRequest{From: "a", To: "t", Relations: []string{"road"}, Depth: depth, Weight: "km"})
+		if err != errNoPath {
+			t.Errorf("depth %d: got %v, want no path", depth, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// the view of the whole cluster served by GET /state, the health and the
+// figures reported by the heartbeats are only known to the zero leader so
+// followers pass the request on to it
+
+type nodeState struct {
+	Id           string    `json:"id"`
+	RaftAddress  string    `json:"raftAddress"`
+	HttpAddress  string    `json:"httpAddress"`
+	Zone         string    `json:"zone,omitempty"`
+	Rack         string    `json:"rack,omitempty"`
+	Health       string    `json:"health"`
+	Leader       bool      `json:"leader"`
+	RaftState    string    `json:"raftState,omitempty"`
+	AppliedIndex uint64    `json:"appliedIndex"`
+	DiskUsage    int64     `json:"diskUsage"`
+	KeyCount     int64     `json:"keyCount"`
+	LastSeen     time.Time `json:"lastSeen"`
+}
+
+type groupState struct {
+	Id         string       `json:"id"`
+	Leader     string       `json:"leader"`
+	Members    int          `json:"members"`
+	Health     string       `json:"health"`
+	Pending    bool         `json:"pending"`
+	KeyCount   int64        `json:"keyCount"`
+	Partitions []int        `json:"partitions"`
+	Tablets    []string     `json:"tablets"`
+	Nodes      []*nodeState `json:"nodes"`
+}
+
+type clusterState struct {
+	Zero           string        `json:"zero"`
+	PartitionCount int           `json:"partitionCount"`
+	Groups         []*groupState `json:"groups"`
+	Tablets        []*tablet     `json:"tablets"`
+}
+
+// state the caller holds z.mut
+func (z *ZeroServer) state() *clusterState {
+	owned := make(map[string][]int)
+	for part := 0; part < z.c.cfg.PartitionCount; part++ {
+		if owner := z.c.c.GetPartitionOwner(part); owner != nil {
+			owned[owner.String()] = append(owned[owner.String()], part)
+		}
+	}
+	cs := &clusterState{
+		Zero:           z.self.Id,
+		PartitionCount: z.c.cfg.PartitionCount,
+		Groups:         make([]*groupState, 0, len(z.gInfo)),
+		Tablets:        make([]*tablet, 0, len(z.tablets)),
+	}
+	for _, relation := range z.tabletRelations() {
+		cs.Tablets = append(cs.Tablets, z.tablets[relation])
+	}
+	for id, entry := range z.gInfo {
+		grp := z.group(id)
+		gs := &groupState{
+			Id:         id,
+			Leader:     entry.leader.GetId(),
+			Members:    entry.members,
+			Health:     grp.GetHealth().String(),
+			Pending:    entry.pending,
+			Partitions: owned[id],
+			Tablets:    []string{},
+			Nodes:      make([]*nodeState, 0, len(grp.GetNodes())),
+		}
+		if gs.Partitions == nil {
+			gs.Partitions = []int{}
+		}
+		for _, t := range cs.Tablets {
+			if t.Group == id {
+				gs.Tablets = append(gs.Tablets, t.Relation)
+			}
+		}
+		for _, n := range grp.GetNodes() {
+			ns := &nodeState{
+				Id:          n.GetId(),
+				RaftAddress: n.GetRaftAddress(),
+				HttpAddress: n.GetHttpAddress(),
+				Zone:        n.GetZone(),
+				Rack:        n.GetRack(),
+				Health:      n.GetHealth().String(),
+				Leader:      n.GetId() == gs.Leader,
+			}
+			if st, ok := z.status[n.GetId()]; ok {
+				ns.RaftState = st.raftState
+				ns.AppliedIndex = st.appliedIndex
+				ns.DiskUsage = st.diskUsage
+				ns.KeyCount = st.keyCount
+				ns.LastSeen = st.lastSeen
+			}
+			// the replicas hold the same keys, the most caught up one tells
+			if ns.KeyCount > gs.KeyCount {
+				gs.KeyCount = ns.KeyCount
+			}
+			gs.Nodes = append(gs.Nodes, ns)
+		}
+		cs.Groups = append(cs.Groups, gs)
+	}
+	sort.Slice(cs.Groups, func(i, j int) bool { return cs.Groups[i].Id < cs.Groups[j].Id })
+	return cs
+}
+
+func (s *httpService) handleState(w http.ResponseWriter, r *http.Request) {
+	if s.forwardToLeader(w, r, nil) {
+		return
+	}
+	s.server.mut.Lock()
+	cs := s.server.state()
+	s.server.mut.Unlock()
+	s.writeJSON(w, cs)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"sort"
+)
+
+// A relation is either hashed, every id%relation key goes where the ring
+// says, or it is a tablet, all its keys live on one group so that reading
+// the relation for many subjects does not hop between groups.
+const (
+	hashMode   = "hash"
+	tabletMode = "tablet"
+)
+
+type tablet struct {
+	Relation string `json:"relation"`
+	Mode     string `json:"mode"`
+	Group    string `json:"group,omitempty"`
+}
+
+// groupFor returns the group serving the key of the relation
+func (z *ZeroServer) groupFor(id, relation string) (string, error) {
+	z.mut.Lock()
+	t, ok := z.tablets[relation]
+	z.mut.Unlock()
+	if ok {
+		return t.Group, nil
+	}
+	return z.c.getGroupForKey(id + SEPARATOR + relation)
+}
+
+// getTablet returns how the relation is placed, the caller holds z.mut
+func (z *ZeroServer) getTablet(relation string) *tablet {
+	if t, ok := z.tablets[relation]; ok {
+		return t
+	}
+	return &tablet{Relation: relation, Mode: hashMode}
+}
+
+// tabletRelations the caller holds z.mut
+func (z *ZeroServer) tabletRelations() []string {
+	relations := make([]string, 0, len(z.tablets))
+	for r := range z.tablets {
+		relations = append(relations, r)
+	}
+	sort.Strings(relations)
+	return relations
+}
+
+// pickTabletGroup returns the group on the ring holding the fewest tablets,
+// the caller holds z.mut
+func (z *ZeroServer) pickTabletGroup() string {
+	counts := make(map[string]int)
+	for _, t := range z.tablets {
+		counts[t.Group]++
+	}
+	best := ""
+	for _, m := range z.c.c.GetMembers() {
+		g := m.String()
+		if best == "" || counts[g] < counts[best] || (counts[g] == counts[best] && g < best) {
+			best = g
+		}
+	}
+	return best
+}
+
+// moveTablet moves the keys of the relation to where the new placement puts
+// them and switches the placement through raft, see moveKeys
+func (z *ZeroServer) moveTablet(next *tablet) error {
+	if !z.isLeader() {
+		return errNotLeader
+	}
+	z.mut.Lock()
+	cur := z.getTablet(next.Relation)
+	// the partitions of the relation each group holds when it is hashed
+	owned := make(map[string][]int)
+	for part := 0; part < z.c.cfg.PartitionCount; part++ {
+		if owner := z.c.c.GetPartitionOwner(part); owner != nil {
+			owned[owner.String()] = append(owned[owner.String()], part)
+		}
+	}
+	z.mut.Unlock()
+
+	hashed := func(grp string) *partitionRequest {
+		return &partitionRequest{Relation: next.Relation, Partitions: owned[grp], PartitionCount: z.c.cfg.PartitionCount}
+	}
+	var moves []keyMove
+	switch {
+	case cur.Mode == tabletMode && next.Mode == tabletMode:
+		if cur.Group != next.Group {
+			moves = append(moves, keyMove{from: cur.Group, to: next.Group, keys: &partitionRequest{Relation: next.Relation}})
+		}
+	case next.Mode == tabletMode:
+		for grp := range owned {
+			if grp != next.Group {
+				moves = append(moves, keyMove{from: grp, to: next.Group, keys: hashed(grp)})
+			}
+		}
+	case cur.Mode == tabletMode:
+		for grp := range owned {
+			if grp != cur.Group {
+				moves = append(moves, keyMove{from: cur.Group, to: grp, keys: hashed(grp)})
+			}
+		}
+	}
+	return z.moveKeys(moves, func() error {
+		return z.propose(&command{OpType: setTablet, Tablet: next})
+	})
+}
+
+func (s *httpService) handleTabletGet(w http.ResponseWriter, r *http.Request) {
+	relation := mux.Vars(r)["relation"]
+	s.server.mut.Lock()
+	t := s.server.getTablet(relation)
+	s.server.mut.Unlock()
+	s.writeJSON(w, t)
+}
+
+// handleTabletPut places the relation, {"mode": "tablet", "group": "..."}
+// puts it on a group, the least loaded one when no group is given, and
+// {"mode": "hash"} spreads it over the ring again
+func (s *httpService) handleTabletPut(w http.ResponseWriter, r *http.Request) {
+	relation := mux.Vars(r)["relation"]
+	b, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		s.writeError(w, 400, "Could not open request body")
+		return
+	}
+	if s.forwardToLeader(w, r, b) {
+		return
+	}
+	var next tablet
+	if err := json.Unmarshal(b, &next); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	next.Relation = relation
+	z := s.server
+	z.mut.Lock()
+	switch next.Mode {
+	case hashMode:
+		next.Group = ""
+	case tabletMode:
+		if next.Group == "" {
+			next.Group = z.pickTabletGroup()
+		}
+		entry, ok := z.gInfo[next.Group]
+		if !ok || entry.pending {
+			z.mut.Unlock()
+			s.writeError(w, 400, fmt.Sprintf("Group %q is not serving keys", next.Group))
+			return
+		}
+	default:
+		z.mut.Unlock()
+		s.writeError(w, 400, "The mode should be hash or tablet")
+		return
+	}
+	cur := z.getTablet(relation)
+	z.mut.Unlock()
+	if *cur != next {
+		err := z.placeTablet(r.Context(), &next)
+		switch {
+		case err == errRebalanceBusy:
+			s.writeError(w, 503, "Other keys are being moved, try again later")
+			return
+		case err != nil && r.Context().Err() != nil:
+			s.writeError(w, 504, "The relation is still moving")
+			return
+		case err != nil:
+			s.logger.Error("Could not move the relation", zap.Error(err))
+			s.writeError(w, 500, "Could not move the relation: "+err.Error())
+			return
+		}
+	}
+	s.writeJSON(w, &next)
+}
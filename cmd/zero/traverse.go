@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"sync"
+)
+
+// POST /traverse follows a path of relations from a node hop by hop and
+// returns the subgraph it went through. Each hop reads the relation of every
+// node reached by the previous one from the groups owning the keys.
+//
+//	{"start": "alice", "path": ["friend", "lives-in"], "depth": 2, "limit": 100}
+//
+// depth defaults to the length of the path and a longer depth repeats the
+// path, {"path": ["friend"], "depth": 3} reaches the friends of friends of
+// friends. limit caps the values followed out of each node. A node is only
+// expanded the first time it is reached so cycles end.
+
+const (
+	maxTraverseDepth = 10
+	defaultFanout    = 100
+	// the subgraph stops growing past this many nodes
+	maxTraverseNodes = 10000
+	// the reads of a hop sent at the same time
+	traverseParallel = 16
+)
+
+// the levels a read can ask for, the alphas define them
+var consistencies = map[string]bool{"": true, "linearizable": true, "leader": true, staleRead: true}
+
+type traverseRequest struct {
+	Start       string   `json:"start"`
+	Path        []string `json:"path"`
+	Depth       int      `json:"depth"`
+	Limit       int      `json:"limit"`
+	Consistency string   `json:"consistency"`
+}
+
+type traverseEdge struct {
+	From     string                 `json:"from"`
+	Relation string                 `json:"relation"`
+	To       string                 `json:"to"`
+	Facets   map[string]interface{} `json:"facets,omitempty"`
+}
+
+// subgraph is the answer of a traversal, truncated is set when the fan-out
+// limit or the node limit left some edges out
+type subgraph struct {
+	Nodes     []string        `json:"nodes"`
+	Edges     []*traverseEdge `json:"edges"`
+	Truncated bool            `json:"truncated"`
+}
+
+// readAll reads the relation of every id in parallel, the values come back
+// in the order of ids
+func (s *httpService) readAll(ctx context.Context, ids []string, relation, consistency string) ([][]edgeValue, error) {
+	out := make([][]edgeValue, len(ids))
+	errs := make([]error, len(ids))
+	sem := make(chan struct{}, traverseParallel)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			out[i], errs[i] = s.values(ctx, id, relation, consistency)
+		}(i, id)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (s *httpService) traverse(ctx context.Context, req *traverseRequest) (*subgraph, error) {
+	g := &subgraph{Nodes: []string{req.Start}, Edges: []*traverseEdge{}}
+	seen := map[string]bool{req.Start: true}
+	frontier := []string{req.Start}
+	for hop := 0; hop < req.Depth && len(frontier) > 0; hop++ {
+		relation := req.Path[hop%len(req.Path)]
+		adj, err := s.readAll(ctx, frontier, relation, req.Consistency)
+		if err != nil {
+			return nil, err
+		}
+		var next []string
+		for i, from := range frontier {
+			vals := adj[i]
+			if len(vals) > req.Limit {
+				vals, g.Truncated = vals[:req.Limit], true
+			}
+			for _, v := range vals {
+				to := v.Value
+				if !seen[to] {
+					if len(seen) >= maxTraverseNodes {
+						g.Truncated = true
+						continue
+					}
+					seen[to] = true
+					g.Nodes = append(g.Nodes, to)
+					next = append(next, to)
+				}
+				g.Edges = append(g.Edges, &traverseEdge{From: from, Relation: relation, To: to, Facets: v.Facets})
+			}
+		}
+		frontier = next
+	}
+	return g, nil
+}
+
+func (s *httpService) handleTraverse(w http.ResponseWriter, r *http.Request) {
+	var req traverseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, 400, "Could not parse Request body")
+		return
+	}
+	if req.Start == "" || len(req.Path) == 0 {
+		s.writeError(w, 400, "The start node and a path of relations are required")
+		return
+	}
+	for _, relation := range req.Path {
+		if relation == "" {
+			s.writeError(w, 400, "The relations of the path can not be empty")
+			return
+		}
+	}
+	if req.Depth == 0 {
+		req.Depth = len(req.Path)
+	}
+	if req.Depth < 0 || req.Depth > maxTraverseDepth {
+		s.writeError(w, 400, fmt.Sprintf("The depth should be between 1 and %d", maxTraverseDepth))
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultFanout
+	}
+	if req.Limit < 0 {
+		s.writeError(w, 400, "The limit should be positive")
+		return
+	}
+	if !consistencies[req.Consistency] {
+		s.writeError(w, 400, "The consistency should be linearizable, leader or stale")
+		return
+	}
+	g, err := s.traverse(r.Context(), &req)
+	if err != nil {
+		s.logger.Info("Could not traverse the graph", zap.Error(err))
+		s.writeError(w, 502, "Could not read a relation: "+err.Error())
+		return
+	}
+	s.writeJSON(w, g)
+}
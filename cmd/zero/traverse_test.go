@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// showEdges writes the edges as a-friend->b
+func showEdges(edges []*traverseEdge) []string {
+	out := make([]string, 0, len(edges))
+	for _, e := range edges {
+		out = append(out, fmt.Sprintf("%s-%s->%s", e.From, e.Relation, e.To))
+	}
+	return out
+}
+
+func TestTraverse(t *testing.T) {
+	data := map[string][]edgeValue{
+		"alice%friend":   {{Value: "bob"}, {Value: "carol"}},
+		"bob%friend":     {{Value: "alice"}, {Value: "dave"}},
+		"carol%friend":   {{Value: "alice"}},
+		"dave%friend":    {{Value: "erin"}},
+		"bob%lives-in":   {{Value: "paris"}},
+		"carol%lives-in": {{Value: "rome"}},
+		"paris%friend":   {{Value: "berlin"}},
+	}
+	tests := []struct {
+		name      string
+		req       traverseRequest
+		nodes     []string
+		edges     []string
+		truncated bool
+	}{
+		{
+			"cycles are expanded once",
+			traverseRequest{Start: "alice", Path: []string{"friend"}, Depth: 4, Limit: 10},
+			[]string{"alice", "bob", "carol", "dave", "erin"},
+			[]string{"alice-friend->bob", "alice-friend->carol", "bob-friend->alice", "bob-friend->dave",
+				"carol-friend->alice", "dave-friend->erin"},
+			false,
+		},
+		{
+			"the path repeats past its length",
+			traverseRequest{Start: "alice", Path: []string{"friend", "lives-in"}, Depth: 3, Limit: 10},
+			[]string{"alice", "bob", "carol", "paris", "rome", "berlin"},
+			[]string{"alice-friend->bob", "alice-friend->carol", "bob-lives-in->paris", "carol-lives-in->rome",
+				"paris-friend->berlin"},
+			false,
+		},
+		{
+			"limit",
+			traverseRequest{Start: "alice", Path: []string{"friend"}, Depth: 2, Limit: 1},
+			[]string{"alice", "bob"},
+			[]string{"alice-friend->bob", "bob-friend->alice"},
+			true,
+		},
+		{
+			"nothing to follow",
+			traverseRequest{Start: "erin", Path: []string{"friend"}, Depth: 3, Limit: 10},
+			[]string{"erin"},
+			[]string{},
+			false,
+		},
+	}
+	s := newTestService(t, data)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := s.traverse(context.Background(), &tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(g.Nodes, tt.nodes) {
+				t.Errorf("nodes %v, want %v", g.Nodes, tt.nodes)
+			}
+			if got := showEdges(g.Edges); !reflect.DeepEqual(got, tt.edges) {
+				t.Errorf("edges %v, want %v", got, tt.edges)
+			}
+			if g.Truncated != tt.truncated {
+				t.Errorf("truncated %v, want %v", g.Truncated, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestTraverseNodeCap(t *testing.T) {
+	friends := make([]edgeValue, maxTraverseNodes+10)
+	for i := range friends {
+		friends[i] = edgeValue{Value: fmt.Sprintf("n%d", i)}
+	}
+	s := newTestService(t, map[string][]edgeValue{"hub%friend": friends})
+	g, err := s.traverse(context.Background(), &traverseRequest{
+		Start: "hub",
+		Path:  []string{"friend"},
+		Depth: 1,
+		Limit: len(friends),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Nodes) != maxTraverseNodes || len(g.Edges) != maxTraverseNodes-1 {
+		t.Errorf("the subgraph has %d nodes and %d edges, want %d and %d",
+			len(g.Nodes), len(g.Edges), maxTraverseNodes, maxTraverseNodes-1)
+	}
+	if !g.Truncated {
+		t.Error("the subgraph past the node cap is not truncated")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	pb "example.com/graphd/cmd/zero/grpc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sort"
+)
+
+// a watcher that does not keep up is dropped, it can watch again to resync
+const watchBuffer = 64
+
+// watch registers a watcher and returns the current groups along with the
+// channel, both are taken under the same lock so no change is missed
+func (z *ZeroServer) watch() ([]*pb.Group, <-chan *pb.GroupEvent, func()) {
+	z.mut.Lock()
+	defer z.mut.Unlock()
+	ch := make(chan *pb.GroupEvent, watchBuffer)
+	id := z.nextWatcher
+	z.nextWatcher++
+	z.watchers[id] = ch
+	ids := make([]string, 0, len(z.gInfo))
+	for k := range z.gInfo {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	grps := make([]*pb.Group, 0, len(ids))
+	for _, k := range ids {
+		grps = append(grps, z.group(k))
+	}
+	cancel := func() {
+		z.mut.Lock()
+		defer z.mut.Unlock()
+		if _, ok := z.watchers[id]; ok {
+			delete(z.watchers, id)
+			close(ch)
+		}
+	}
+	return grps, ch, cancel
+}
+
+// publish sends the event to every watcher, the caller holds z.mut
+func (z *ZeroServer) publish(typ pb.GroupEvent_Type, grp string, node *pb.Node) {
+	if len(z.watchers) == 0 {
+		return
+	}
+	ev := &pb.GroupEvent{
+		Type:  typ,
+		Group: z.group(grp),
+		Node:  node,
+	}
+	for id, ch := range z.watchers {
+		select {
+		case ch <- ev:
+		default:
+			z.logger.Info("Dropping a slow watcher")
+			delete(z.watchers, id)
+			close(ch)
+		}
+	}
+}
+
+// WatchGroups streams the groups and then every change applied to them,
+// any zero can serve it since every zero applies the same log
+func (z *ZeroServer) WatchGroups(req *pb.WatchRequest, stream pb.Zero_WatchGroupsServer) error {
+	grps, ch, cancel := z.watch()
+	defer cancel()
+	for _, g := range grps {
+		if err := stream.Send(&pb.GroupEvent{Type: pb.GroupEvent_SYNC, Group: g}); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-ch:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell behind, watch again")
+			}
+			if err := stream.Send(ev); err != nil {
+				z.logger.Info("Could not send group event", zap.Error(err))
+				return err
+			}
+		}
+	}
+}